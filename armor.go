@@ -0,0 +1,272 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Selects how UseArmor turns messages into text.
+type ArmorFormat int
+
+const (
+	// Standard Base64 (RFC 4648) lines.
+	ArmorBase64 ArmorFormat = iota
+	// Standard Base32 (RFC 4648) lines, which avoid lower case and symbols other than '='.
+	ArmorBase32
+	// Lower case hexadecimal lines.
+	ArmorHex
+	// Base64 lines between "-----BEGIN OTW MESSAGE-----" and "-----END OTW MESSAGE-----" lines, in the style of PEM and OpenPGP armor.
+	ArmorPEM
+)
+
+const (
+	armorLineLength = 64
+	armorBegin      = "-----BEGIN OTW MESSAGE-----"
+	armorEnd        = "-----END OTW MESSAGE-----"
+)
+
+var (
+	ErrArmorMalformed = fmt.Errorf("armored message is malformed")
+	ErrArmorChecksum  = fmt.Errorf("armored message checksum does not match")
+)
+
+func (f ArmorFormat) encode(data []byte) string {
+	switch f {
+	case ArmorBase32:
+		return base32.StdEncoding.EncodeToString(data)
+	case ArmorHex:
+		return hex.EncodeToString(data)
+	default:
+		return base64.StdEncoding.EncodeToString(data)
+	}
+}
+
+// Returns the length of the encoded text for n bytes of data.
+func (f ArmorFormat) encodedLen(n int) int {
+	switch f {
+	case ArmorBase32:
+		return base32.StdEncoding.EncodedLen(n)
+	case ArmorHex:
+		return hex.EncodedLen(n)
+	default:
+		return base64.StdEncoding.EncodedLen(n)
+	}
+}
+
+func (f ArmorFormat) decode(text string) ([]byte, error) {
+	switch f {
+	case ArmorBase32:
+		return base32.StdEncoding.DecodeString(strings.ToUpper(text))
+	case ArmorHex:
+		return hex.DecodeString(text)
+	default:
+		return base64.StdEncoding.DecodeString(text)
+	}
+}
+
+// Computes the 24 bit CRC used by OpenPGP armor (RFC 4880).
+func crc24(data []byte) []byte {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for range 8 {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return []byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}
+}
+
+// Creates the func that writes a whole message to w as armored text: the encoded data wrapped at 64 columns, followed by a line of '=' and the encoded CRC-24 checksum. Encoded data never has a line starting with '=', so the checksum line also marks the end of the message.
+func writeArmored(format ArmorFormat) func([]byte, io.Writer) (int, error) {
+	return func(data []byte, w io.Writer) (int, error) {
+		text := strings.Builder{}
+
+		if format == ArmorPEM {
+			text.WriteString(armorBegin + "\n")
+		}
+
+		encoded := format.encode(data)
+		for i := 0; i < len(encoded); i += armorLineLength {
+			text.WriteString(encoded[i:min(i+armorLineLength, len(encoded))])
+			text.WriteByte('\n')
+		}
+
+		text.WriteString("=" + format.encode(crc24(data)) + "\n")
+
+		if format == ArmorPEM {
+			text.WriteString(armorEnd + "\n")
+		}
+
+		logger.Debug("Writing armored message", "ByteCount", text.Len())
+		return writeFull(w, []byte(text.String()))
+	}
+}
+
+// Creates the func that reads a whole armored message written by writeArmored from r. Whitespace within and around the lines is ignored.
+//
+// Since the end of the message is only known once the checksum line has been read, r is read one byte at a time so nothing past the message is consumed. Readers implementing io.ByteReader, such as a bufio.Reader, are used as they are.
+//
+// If maxSize is more than zero, reading fails with ErrMessageTooLarge as soon as the text is longer than a message of maxSize bytes would be.
+func readArmored(format ArmorFormat, maxSize int) func(io.Reader) ([]byte, int, error) {
+	maxTextLen := -1
+	if maxSize > 0 {
+		maxTextLen = format.encodedLen(maxSize)
+	}
+
+	return func(r io.Reader) ([]byte, int, error) {
+		lines := newArmorLineReader(r)
+		if maxTextLen >= 0 {
+			// No line of a message that fits is longer than its text or the BEGIN line
+			lines.maxLen = max(maxTextLen, len(armorBegin)) + 1
+		}
+
+		line, err := lines.next()
+		if err != nil {
+			return nil, lines.count, err
+		}
+
+		if format == ArmorPEM {
+			if line != stripWhitespace(armorBegin) {
+				logger.Error("Failed to read armored message. Expected the BEGIN line", "Error", ErrArmorMalformed)
+				return nil, lines.count, ErrArmorMalformed
+			}
+			if line, err = lines.next(); err != nil {
+				return nil, lines.count, armorUnexpectedEOF(err)
+			}
+		}
+
+		body := strings.Builder{}
+		for !strings.HasPrefix(line, "=") {
+			body.WriteString(line)
+			if maxTextLen >= 0 && body.Len() > maxTextLen {
+				logger.Error("Failed to read armored message. The message exceeds the limit", "Limit", maxSize)
+				return nil, lines.count, fmt.Errorf("%w: exceeds the limit of %d bytes", ErrMessageTooLarge, maxSize)
+			}
+			if line, err = lines.next(); err != nil {
+				return nil, lines.count, armorUnexpectedEOF(err)
+			}
+		}
+
+		if format == ArmorPEM {
+			end, err := lines.next()
+			if err != nil {
+				return nil, lines.count, armorUnexpectedEOF(err)
+			}
+			if end != stripWhitespace(armorEnd) {
+				logger.Error("Failed to read armored message. Expected the END line", "Error", ErrArmorMalformed)
+				return nil, lines.count, ErrArmorMalformed
+			}
+		}
+
+		data, err := format.decode(body.String())
+		if err != nil {
+			logger.Error("Failed to decode armored message", "Error", err)
+			return nil, lines.count, fmt.Errorf("%w: %w", ErrArmorMalformed, err)
+		}
+
+		// Encoded lengths are only a multiple of a few bytes, so check the exact size once decoded
+		if maxSize > 0 && len(data) > maxSize {
+			logger.Error("Failed to read armored message. The message exceeds the limit", "ByteCount", len(data), "Limit", maxSize)
+			return nil, lines.count, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrMessageTooLarge, len(data), maxSize)
+		}
+
+		checksum, err := format.decode(line[1:])
+		if err != nil {
+			logger.Error("Failed to decode armored message checksum", "Error", err)
+			return nil, lines.count, fmt.Errorf("%w: %w", ErrArmorMalformed, err)
+		}
+
+		if !bytes.Equal(checksum, crc24(data)) {
+			logger.Error("Failed to verify armored message", "Error", ErrArmorChecksum)
+			return nil, lines.count, ErrArmorChecksum
+		}
+
+		logger.Debug("Read armored message", "ByteCount", lines.count)
+		return data, lines.count, nil
+	}
+}
+
+func armorUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Reads non-blank lines with all whitespace removed, without reading past the end of each line.
+type armorLineReader struct {
+	r      io.ByteReader
+	count  int
+	maxLen int
+}
+
+func newArmorLineReader(r io.Reader) *armorLineReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return &armorLineReader{r: br}
+	}
+	return &armorLineReader{r: &singleByteReader{r: r}}
+}
+
+// Returns the next non-blank line, or io.EOF if r ends before one is found.
+func (l *armorLineReader) next() (string, error) {
+	line := strings.Builder{}
+	for {
+		b, err := l.r.ReadByte()
+		if err == io.EOF {
+			if stripped := stripWhitespace(line.String()); stripped != "" {
+				return stripped, nil
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		l.count++
+
+		if b != '\n' {
+			// Whitespace is dropped as it is read so it doesn't count towards the line length
+			if b != ' ' && b != '\t' && b != '\r' {
+				line.WriteByte(b)
+			}
+			if l.maxLen > 0 && line.Len() > l.maxLen {
+				logger.Error("Failed to read armored message. A line exceeds the limit", "Limit", l.maxLen)
+				return "", fmt.Errorf("%w: line exceeds %d characters", ErrMessageTooLarge, l.maxLen)
+			}
+			continue
+		}
+
+		if stripped := stripWhitespace(line.String()); stripped != "" {
+			return stripped, nil
+		}
+		line.Reset()
+	}
+}
+
+type singleByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (s *singleByteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+		return 0, err
+	}
+	return s.buf[0], nil
+}
@@ -32,10 +32,16 @@ func asymmetricEncrypt(publicKeyFn func() *rsa.PublicKey) func([]byte) ([]byte,
 				return nil, err
 			}
 
-			writeLV(encrypted, buffer)
+			if _, err := writeLV(encrypted, buffer); err != nil {
+				logger.Error("Failed to write encrypted chunk", "Error", err)
+				return nil, err
+			}
 		}
 
-		writeLV([]byte{}, buffer)
+		if _, err := writeLV([]byte{}, buffer); err != nil {
+			logger.Error("Failed to write stop chunk", "Error", err)
+			return nil, err
+		}
 
 		logger.Debug("Successfully encrypted using public key", "ByteCount", len(buffer.Bytes()))
 		return buffer.Bytes(), nil
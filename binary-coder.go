@@ -0,0 +1,231 @@
+package onthewire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+type binaryPlanKind int
+
+const (
+	binaryFixed binaryPlanKind = iota
+	binaryVarint
+	binaryUvarint
+	binaryPadding
+	binaryStruct
+	binaryArray
+)
+
+// Describes how a value of a plain-data type is laid out on the wire. Fixed size parts are handled by `encoding/binary`, while fields tagged with `otw:"varint"` are written as (unsigned) varints.
+type binaryPlan struct {
+	kind   binaryPlanKind
+	typ    reflect.Type
+	fields []binaryFieldPlan
+	elem   *binaryPlan
+}
+
+type binaryFieldPlan struct {
+	index int
+	plan  *binaryPlan
+}
+
+// Builds the encoder and decoder for T, or returns an error if T contains fields that have no fixed size layout.
+func binaryCoder[T any](order binary.ByteOrder) (func(T) ([]byte, error), func([]byte) (T, error), error) {
+	typ := reflect.TypeFor[T]()
+	plan, err := newBinaryPlan(typ, typ.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encode := func(t T) ([]byte, error) {
+		encoded, err := plan.append(nil, order, reflect.ValueOf(t))
+		if err != nil {
+			logger.Error("Failed to binary encode", "Error", err)
+			return nil, err
+		}
+
+		logger.Debug("Binary encoded", "Type", typ, "ByteCount", len(encoded), "Bytes", logBytes(encoded, typ))
+		return encoded, nil
+	}
+
+	decode := func(data []byte) (T, error) {
+		t := *new(T)
+
+		n, err := plan.decode(data, order, reflect.ValueOf(&t).Elem())
+		if err == nil && n != len(data) {
+			err = fmt.Errorf("binary: %d unexpected trailing bytes", len(data)-n)
+		}
+		if err != nil {
+			logger.Error("Failed to binary decode", "Error", err)
+			return t, err
+		}
+
+		logger.Debug("Binary decoded", "Type", typ, "Instance", logInstance(t))
+		return t, nil
+	}
+
+	return encode, decode, nil
+}
+
+func newBinaryPlan(t reflect.Type, path string) (*binaryPlan, error) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return &binaryPlan{kind: binaryFixed, typ: t}, nil
+	case reflect.Int, reflect.Uint:
+		return nil, fmt.Errorf("binary: %s has platform dependent size %s, use a sized integer or tag it with `otw:\"varint\"`", path, t)
+	case reflect.Array:
+		elem, err := newBinaryPlan(t.Elem(), path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		if elem.kind == binaryFixed {
+			return &binaryPlan{kind: binaryFixed, typ: t}, nil
+		}
+		return &binaryPlan{kind: binaryArray, typ: t, elem: elem}, nil
+	case reflect.Struct:
+		return newBinaryStructPlan(t, path)
+	default:
+		return nil, fmt.Errorf("binary: %s has variable size type %s which cannot be binary encoded", path, t)
+	}
+}
+
+func newBinaryStructPlan(t reflect.Type, path string) (*binaryPlan, error) {
+	plan := &binaryPlan{kind: binaryStruct, typ: t}
+	allFixed := true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldPath := path + "." + f.Name
+
+		if f.Name == "_" {
+			padding, err := newBinaryPlan(f.Type, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+			if padding.kind != binaryFixed {
+				return nil, fmt.Errorf("binary: %s is a blank field with varint fields", fieldPath)
+			}
+			plan.fields = append(plan.fields, binaryFieldPlan{index: i, plan: &binaryPlan{kind: binaryPadding, typ: f.Type}})
+			continue
+		}
+
+		if !f.IsExported() {
+			return nil, fmt.Errorf("binary: %s is unexported and cannot be binary decoded", fieldPath)
+		}
+
+		var fieldPlan *binaryPlan
+		if hasOTWOption(f, "varint") {
+			switch f.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				fieldPlan = &binaryPlan{kind: binaryVarint, typ: f.Type}
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				fieldPlan = &binaryPlan{kind: binaryUvarint, typ: f.Type}
+			default:
+				return nil, fmt.Errorf("binary: %s is tagged as varint but has non-integer type %s", fieldPath, f.Type)
+			}
+		} else {
+			var err error
+			if fieldPlan, err = newBinaryPlan(f.Type, fieldPath); err != nil {
+				return nil, err
+			}
+		}
+
+		if fieldPlan.kind != binaryFixed {
+			allFixed = false
+		}
+		plan.fields = append(plan.fields, binaryFieldPlan{index: i, plan: fieldPlan})
+	}
+
+	// Structs without varints can be handed to encoding/binary in one go
+	if allFixed {
+		return &binaryPlan{kind: binaryFixed, typ: t}, nil
+	}
+
+	return plan, nil
+}
+
+func (p *binaryPlan) append(b []byte, order binary.ByteOrder, v reflect.Value) ([]byte, error) {
+	var err error
+
+	switch p.kind {
+	case binaryFixed:
+		return binary.Append(b, order, v.Interface())
+	case binaryVarint:
+		return binary.AppendVarint(b, v.Int()), nil
+	case binaryUvarint:
+		return binary.AppendUvarint(b, v.Uint()), nil
+	case binaryPadding:
+		return append(b, make([]byte, binary.Size(reflect.Zero(p.typ).Interface()))...), nil
+	case binaryArray:
+		for i := 0; i < v.Len(); i++ {
+			if b, err = p.elem.append(b, order, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		for _, f := range p.fields {
+			if b, err = f.plan.append(b, order, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+}
+
+// Decodes data into v, returning the number of bytes consumed.
+func (p *binaryPlan) decode(data []byte, order binary.ByteOrder, v reflect.Value) (int, error) {
+	switch p.kind {
+	case binaryFixed:
+		return binary.Decode(data, order, v.Addr().Interface())
+	case binaryVarint:
+		i, n := binary.Varint(data)
+		if n <= 0 {
+			return 0, fmt.Errorf("binary: invalid varint for %s", p.typ)
+		}
+		if v.OverflowInt(i) {
+			return 0, fmt.Errorf("binary: %d overflows %s", i, p.typ)
+		}
+		v.SetInt(i)
+		return n, nil
+	case binaryUvarint:
+		u, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, fmt.Errorf("binary: invalid uvarint for %s", p.typ)
+		}
+		if v.OverflowUint(u) {
+			return 0, fmt.Errorf("binary: %d overflows %s", u, p.typ)
+		}
+		v.SetUint(u)
+		return n, nil
+	case binaryPadding:
+		n := binary.Size(reflect.Zero(p.typ).Interface())
+		if n > len(data) {
+			return 0, fmt.Errorf("binary: unexpected end of data")
+		}
+		return n, nil
+	case binaryArray:
+		total := 0
+		for i := 0; i < v.Len(); i++ {
+			n, err := p.elem.decode(data[total:], order, v.Index(i))
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+		return total, nil
+	default:
+		total := 0
+		for _, f := range p.fields {
+			n, err := f.plan.decode(data[total:], order, v.Field(f.index))
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+		return total, nil
+	}
+}
@@ -2,6 +2,7 @@ package onthewire
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 )
 
@@ -15,37 +16,60 @@ func bytesToInt(b []byte) int {
 	return int(binary.BigEndian.Uint32(b))
 }
 
-func writeLV(data []byte, w io.Writer) (int, error) {
-	sizeBytes := intToBytes(len(data))
-	sn, err := w.Write(sizeBytes)
-	if err != nil {
-		return 0, err
+// Writes all of data to w, reporting io.ErrShortWrite for writers that write less than asked without an error.
+func writeFull(w io.Writer, data []byte) (int, error) {
+	n, err := w.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
 	}
+	return n, err
+}
 
-	dn, err := w.Write(data)
+// Writes data to w as its 4 byte length followed by the data itself, returning the number of bytes written and any error that stopped it.
+func writeLV(data []byte, w io.Writer) (int, error) {
+	sn, err := writeFull(w, intToBytes(len(data)))
 	if err != nil {
-		return 0, nil
+		return sn, err
 	}
 
-	return sn + dn, nil
+	dn, err := writeFull(w, data)
+	return sn + dn, err
 }
 
+// Reads a length and value written by writeLV from r. Short reads, as happen on connections and pipes, are read until complete. io.EOF is only returned if r ends before the length, and io.ErrUnexpectedEOF if it ends anywhere within the length or value.
 func readLV(r io.Reader) ([]byte, int, error) {
 	sizeBytes := make([]byte, 4)
-	if _, err := r.Read(sizeBytes); err != nil {
-		return nil, 0, err
+	if n, err := io.ReadFull(r, sizeBytes); err != nil {
+		return nil, n, err
 	}
 
-	dataSize := bytesToInt(sizeBytes)
+	data, n, err := readValue(r, bytesToInt(sizeBytes), -1)
+	return data, 4 + n, err
+}
 
+// Reads a value of dataSize bytes from r, failing with ErrMessageTooLarge before allocating if dataSize is more than limit. A negative limit means no limit.
+func readValue(r io.Reader, dataSize int, limit int) ([]byte, int, error) {
 	if dataSize == 0 {
-		return []byte{}, 4, nil
+		return []byte{}, 0, nil
+	}
+
+	if limit >= 0 && dataSize > limit {
+		logger.Error("Failed to read value. The length exceeds the limit", "ByteCount", dataSize, "Limit", limit)
+		return nil, 0, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrMessageTooLarge, dataSize, limit)
+	}
+
+	// Readers holding their data in memory can't have more than they hold, so don't allocate for a length they can't fill
+	if lr, ok := r.(interface{ Len() int }); ok && dataSize > lr.Len() {
+		return nil, 0, io.ErrUnexpectedEOF
 	}
 
 	data := make([]byte, dataSize)
-	if _, err := r.Read(data); err != nil {
-		return nil, 4, err
+	if n, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, n, err
 	}
 
-	return data, 4 + len(data), nil
+	return data, dataSize, nil
 }
@@ -0,0 +1,157 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Integers beyond this cannot all be represented exactly as an IEEE 754 double, which is the only number type canonical JSON allows.
+const maxCanonicalJSONInteger = 1<<53 - 1
+
+func canonicalJSONEncode[T any](t T) ([]byte, error) {
+	encoded, err := canonicalJSONMarshal(t)
+	if err != nil {
+		logger.Error("Failed to canonical JSON encode", "Error", err)
+		return nil, err
+	}
+
+	logger.Debug("Canonical JSON encoded", "Type", reflect.TypeOf(t), "ByteCount", len(encoded), "Bytes", logBytes(encoded, reflect.TypeOf(t)))
+	return encoded, nil
+}
+
+// Encodes v as canonical JSON in the style of RFC 8785: object keys sorted by their UTF-16 code units, numbers in their shortest ECMAScript form, minimal string escaping and no insignificant whitespace.
+func canonicalJSONMarshal(v any) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return canonicalJSONAppend(nil, generic)
+}
+
+func canonicalJSONAppend(b []byte, v any) ([]byte, error) {
+	var err error
+
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case json.Number:
+		return canonicalJSONAppendNumber(b, v)
+	case string:
+		return canonicalJSONAppendString(b, v), nil
+	case []any:
+		b = append(b, '[')
+		for i, e := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = canonicalJSONAppend(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+		})
+
+		b = append(b, '{')
+		for i, k := range keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = canonicalJSONAppendString(b, k)
+			b = append(b, ':')
+			if b, err = canonicalJSONAppend(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	default:
+		return nil, fmt.Errorf("canonical json: unexpected value of type %T", v)
+	}
+}
+
+func canonicalJSONAppendNumber(b []byte, n json.Number) ([]byte, error) {
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return nil, fmt.Errorf("canonical json: invalid number %s: %w", n, err)
+	}
+
+	// Large floats are also written without a fraction or exponent, but as the shortest text for their value, so only integers that change when written as a double are rejected
+	if !strings.ContainsAny(n.String(), ".eE") && math.Abs(f) > maxCanonicalJSONInteger && strconv.FormatFloat(f, 'f', -1, 64) != n.String() {
+		return nil, fmt.Errorf("canonical json: integer %s cannot be represented exactly as an IEEE 754 double", n)
+	}
+
+	if f == 0 {
+		return append(b, '0'), nil
+	}
+
+	// Follows the ECMAScript Number.prototype.toString rules, which switch to exponent form outside [1e-6, 1e21)
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if format == 'e' {
+		// Go writes at least two exponent digits, ECMAScript does not
+		if i := strings.LastIndexAny(s, "+-"); i > 0 && s[i+1] == '0' && len(s) == i+3 {
+			s = s[:i+1] + s[i+2:]
+		}
+	}
+
+	return append(b, s...), nil
+}
+
+func canonicalJSONAppendString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	b = append(b, '"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b = append(b, '\\', '"')
+		case '\\':
+			b = append(b, '\\', '\\')
+		case '\b':
+			b = append(b, '\\', 'b')
+		case '\f':
+			b = append(b, '\\', 'f')
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if r < 0x20 {
+				b = append(b, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+			} else {
+				b = append(b, string(r)...)
+			}
+		}
+	}
+	return append(b, '"')
+}
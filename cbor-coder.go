@@ -0,0 +1,844 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	cborMajorUint byte = iota << 5
+	cborMajorNegInt
+	cborMajorBytes
+	cborMajorText
+	cborMajorArray
+	cborMajorMap
+	cborMajorTag
+	cborMajorSimple
+)
+
+const (
+	cborFalse     byte = 0xf4
+	cborTrue      byte = 0xf5
+	cborNull      byte = 0xf6
+	cborUndefined byte = 0xf7
+	cborFloat16   byte = 0xf9
+	cborFloat32   byte = 0xfa
+	cborFloat64   byte = 0xfb
+)
+
+const (
+	cborTagDateTimeString = 0
+	cborTagEpochDateTime  = 1
+)
+
+func cborEncode[T any](t T) ([]byte, error) {
+	encoded, err := cborMarshal(t)
+	if err != nil {
+		logger.Error("Failed to CBOR encode", "Error", err)
+		return nil, err
+	}
+
+	logger.Debug("CBOR encoded", "Type", reflect.TypeOf(t), "ByteCount", len(encoded), "Bytes", logBytes(encoded, reflect.TypeOf(t)))
+	return encoded, nil
+}
+
+func cborDecode[T any](data []byte) (T, error) {
+	t := *new(T)
+	if err := cborUnmarshal(data, &t); err != nil {
+		logger.Error("Failed to CBOR decode", "Error", err)
+		return t, err
+	}
+
+	logger.Debug("CBOR decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
+	return t, nil
+}
+
+// Encodes v following the core deterministic encoding requirements of RFC 8949 section 4.2.1: shortest form arguments and floats, definite lengths only and map keys sorted by their encoded bytes.
+func cborMarshal(v any) ([]byte, error) {
+	return cborAppendValue(nil, reflect.ValueOf(v))
+}
+
+func cborUnmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cbor: decode target must be a non-nil pointer, got %T", v)
+	}
+
+	d := &cborDecoder{data: data}
+	if err := d.decodeValue(rv.Elem()); err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return fmt.Errorf("cbor: %d unexpected trailing bytes", len(d.data)-d.pos)
+	}
+
+	return nil
+}
+
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func cborAppendValue(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, cborNull), nil
+	}
+
+	if v.Type() == timeType {
+		return cborAppendTime(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, cborTrue), nil
+		}
+		return append(b, cborFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			return cborAppendHead(b, cborMajorNegInt, uint64(-1-i)), nil
+		}
+		return cborAppendHead(b, cborMajorUint, uint64(i)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cborAppendHead(b, cborMajorUint, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return cborAppendFloat(b, v.Float()), nil
+	case reflect.String:
+		return append(cborAppendHead(b, cborMajorText, uint64(v.Len())), v.String()...), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, cborNull), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(cborAppendHead(b, cborMajorBytes, uint64(v.Len())), v.Bytes()...), nil
+		}
+		return cborAppendArray(b, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return append(cborAppendHead(b, cborMajorBytes, uint64(len(data))), data...), nil
+		}
+		return cborAppendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, cborNull), nil
+		}
+		return cborAppendMap(b, v)
+	case reflect.Struct:
+		return cborAppendStruct(b, v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, cborNull), nil
+		}
+		return cborAppendValue(b, v.Elem())
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+}
+
+// Floats are written in the shortest of half, single or double precision that preserves the value exactly. NaN is always written as the half precision quiet NaN.
+func cborAppendFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) {
+		return append(b, cborFloat16, 0x7e, 0x00)
+	}
+
+	f32 := float32(f)
+	if float64(f32) != f {
+		return binary.BigEndian.AppendUint64(append(b, cborFloat64), math.Float64bits(f))
+	}
+
+	if f16, ok := float32ToFloat16(f32); ok {
+		return binary.BigEndian.AppendUint16(append(b, cborFloat16), f16)
+	}
+
+	return binary.BigEndian.AppendUint32(append(b, cborFloat32), math.Float32bits(f32))
+}
+
+// Converts f to IEEE 754 half precision, reporting whether the conversion was exact.
+func float32ToFloat16(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign, true
+	case math.IsInf(float64(f), 0):
+		return sign | 0x7c00, true
+	case exp >= -14 && exp <= 15:
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14:
+		full := mant | 1<<23
+		shift := uint(13 + (-14 - exp))
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	default:
+		return 0, false
+	}
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(h >> 10 & 0x1f)
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(mant+1024, exp-25)
+	}
+}
+
+func cborAppendArray(b []byte, v reflect.Value) ([]byte, error) {
+	b = cborAppendHead(b, cborMajorArray, uint64(v.Len()))
+
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if b, err = cborAppendValue(b, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+type cborEntry struct {
+	key   []byte
+	value reflect.Value
+}
+
+// Writes the entries as a map in canonical order, bytewise lexicographic on the encoded keys.
+func cborAppendEntries(b []byte, entries []cborEntry) ([]byte, error) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	for i := 1; i < len(entries); i++ {
+		if bytes.Equal(entries[i-1].key, entries[i].key) {
+			return nil, fmt.Errorf("cbor: duplicate map key %x", entries[i].key)
+		}
+	}
+
+	b = cborAppendHead(b, cborMajorMap, uint64(len(entries)))
+
+	var err error
+	for _, e := range entries {
+		b = append(b, e.key...)
+		if b, err = cborAppendValue(b, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func cborAppendMap(b []byte, v reflect.Value) ([]byte, error) {
+	entries := make([]cborEntry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := cborAppendValue(nil, iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, cborEntry{key: key, value: iter.Value()})
+	}
+
+	return cborAppendEntries(b, entries)
+}
+
+func cborAppendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	fields := structFields(v.Type(), "cbor")
+
+	entries := make([]cborEntry, 0, len(fields))
+	for _, f := range fields {
+		// Fields promoted through a nil embedded pointer are left out
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		key := append(cborAppendHead(nil, cborMajorText, uint64(len(f.name))), f.name...)
+		entries = append(entries, cborEntry{key: key, value: fv})
+	}
+
+	return cborAppendEntries(b, entries)
+}
+
+// Whole second times are written as an epoch integer (tag 1), anything finer as an RFC 3339 string in UTC (tag 0) so no precision is lost.
+func cborAppendTime(b []byte, t time.Time) []byte {
+	if t.Nanosecond() == 0 {
+		b = cborAppendHead(b, cborMajorTag, cborTagEpochDateTime)
+		sec := t.Unix()
+		if sec < 0 {
+			return cborAppendHead(b, cborMajorNegInt, uint64(-1-sec))
+		}
+		return cborAppendHead(b, cborMajorUint, uint64(sec))
+	}
+
+	s := t.UTC().Format(time.RFC3339Nano)
+	b = cborAppendHead(b, cborMajorTag, cborTagDateTimeString)
+	return append(cborAppendHead(b, cborMajorText, uint64(len(s))), s...)
+}
+
+type cborDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// Tracks the nesting depth of the value being decoded, which must be undone with leave once it is. Limited to maxDecodeDepth as for MessagePack.
+func (d *cborDecoder) enter() error {
+	d.depth++
+	if d.depth > maxDecodeDepth {
+		return fmt.Errorf("cbor: exceeded max nesting depth of %d", maxDecodeDepth)
+	}
+	return nil
+}
+
+func (d *cborDecoder) leave() {
+	d.depth--
+}
+
+func (d *cborDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("cbor: unexpected end of data")
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// Reads an initial byte and its argument, returning the major type, the additional information and the argument.
+func (d *cborDecoder) readHead() (byte, byte, uint64, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	d.pos++
+
+	major := c & 0xe0
+	info := c & 0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		b, err := d.readN(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var n uint64
+		for _, x := range b {
+			n = n<<8 | uint64(x)
+		}
+		return major, info, n, nil
+	case info == 31:
+		return 0, 0, 0, fmt.Errorf("cbor: indefinite length items are not supported")
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+}
+
+// Rejects container lengths that could not possibly fit in the remaining data.
+func (d *cborDecoder) checkLength(n uint64, minElementSize uint64) error {
+	if n > uint64(len(d.data)-d.pos)/minElementSize {
+		return fmt.Errorf("cbor: length %d exceeds remaining data", n)
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeValue(v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	if c == cborNull || c == cborUndefined {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Type() == timeType {
+		t, err := d.decodeTime()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cbor: cannot decode into non-empty interface %s", v.Type())
+		}
+		value, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.Bool:
+		d.pos++
+		switch c {
+		case cborFalse:
+			v.SetBool(false)
+		case cborTrue:
+			v.SetBool(true)
+		default:
+			return fmt.Errorf("cbor: cannot decode 0x%02x into %s", c, v.Type())
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		major, _, n, err := d.readHead()
+		if err != nil {
+			return err
+		}
+		var i int64
+		switch {
+		case major == cborMajorUint && n <= math.MaxInt64:
+			i = int64(n)
+		case major == cborMajorNegInt && n <= math.MaxInt64:
+			i = -1 - int64(n)
+		default:
+			return fmt.Errorf("cbor: cannot decode 0x%02x into %s", c, v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("cbor: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		major, _, n, err := d.readHead()
+		if err != nil {
+			return err
+		}
+		if major != cborMajorUint {
+			return fmt.Errorf("cbor: cannot decode 0x%02x into %s", c, v.Type())
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("cbor: %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := d.decodeFloat()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		s, err := d.decodeString(cborMajorText, cborMajorBytes)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(s))
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && c&0xe0 == cborMajorBytes {
+			s, err := d.decodeString(cborMajorBytes)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, s...))
+			return nil
+		}
+		n, err := d.decodeContainerHead(cborMajorArray)
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decodeValue(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && c&0xe0 == cborMajorBytes {
+			s, err := d.decodeString(cborMajorBytes)
+			if err != nil {
+				return err
+			}
+			if len(s) != v.Len() {
+				return fmt.Errorf("cbor: cannot decode %d bytes into %s", len(s), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(s))
+			return nil
+		}
+		n, err := d.decodeContainerHead(cborMajorArray)
+		if err != nil {
+			return err
+		}
+		if n != v.Len() {
+			return fmt.Errorf("cbor: cannot decode array of %d elements into %s", n, v.Type())
+		}
+		for i := 0; i < n; i++ {
+			if err := d.decodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		n, err := d.decodeContainerHead(cborMajorMap)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decodeValue(key); err != nil {
+				return err
+			}
+			// Interface keys can hold decoded slices and maps, which can't be used as keys
+			if !key.Comparable() {
+				return fmt.Errorf("cbor: unsupported map key of type %s", key.Elem().Type())
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decodeValue(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		return d.decodeStruct(v)
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+}
+
+func (d *cborDecoder) decodeStruct(v reflect.Value) error {
+	n, err := d.decodeContainerHead(cborMajorMap)
+	if err != nil {
+		return err
+	}
+
+	fields := structFields(v.Type(), "cbor")
+	byName := make(map[string]structField, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := d.decodeString(cborMajorText)
+		if err != nil {
+			return err
+		}
+
+		f, ok := byName[string(name)]
+		if !ok {
+			if _, err := d.decodeAny(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.decodeValue(fieldByIndexAlloc(v, f.index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *cborDecoder) decodeString(majors ...byte) ([]byte, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	major, _, n, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range majors {
+		if major == m {
+			return d.readN(n)
+		}
+	}
+
+	return nil, fmt.Errorf("cbor: expected string, got 0x%02x", c)
+}
+
+func (d *cborDecoder) decodeContainerHead(expected byte) (int, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+
+	major, _, n, err := d.readHead()
+	if err != nil {
+		return 0, err
+	}
+
+	if major != expected {
+		return 0, fmt.Errorf("cbor: expected major type %d, got 0x%02x", expected>>5, c)
+	}
+
+	minElementSize := uint64(1)
+	if major == cborMajorMap {
+		minElementSize = 2
+	}
+	if err := d.checkLength(n, minElementSize); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (d *cborDecoder) decodeFloat() (float64, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+
+	switch c {
+	case cborFloat16, cborFloat32, cborFloat64:
+		_, _, n, err := d.readHead()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case cborFloat16:
+			return float16ToFloat64(uint16(n)), nil
+		case cborFloat32:
+			return float64(math.Float32frombits(uint32(n))), nil
+		default:
+			return math.Float64frombits(n), nil
+		}
+	}
+
+	major, _, n, err := d.readHead()
+	if err != nil {
+		return 0, err
+	}
+
+	switch major {
+	case cborMajorUint:
+		return float64(n), nil
+	case cborMajorNegInt:
+		return -1 - float64(n), nil
+	default:
+		return 0, fmt.Errorf("cbor: expected number, got 0x%02x", c)
+	}
+}
+
+func (d *cborDecoder) decodeTime() (time.Time, error) {
+	c, err := d.peek()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	major, _, tag, err := d.readHead()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if major != cborMajorTag {
+		return time.Time{}, fmt.Errorf("cbor: expected date/time tag, got 0x%02x", c)
+	}
+
+	switch tag {
+	case cborTagDateTimeString:
+		s, err := d.decodeString(cborMajorText)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, string(s))
+	case cborTagEpochDateTime:
+		c, err := d.peek()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if c&0xe0 == cborMajorUint || c&0xe0 == cborMajorNegInt {
+			var sec int64
+			if err := d.decodeValue(reflect.ValueOf(&sec).Elem()); err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+		f, err := d.decodeFloat()
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	default:
+		return time.Time{}, fmt.Errorf("cbor: unsupported date/time tag %d", tag)
+	}
+}
+
+// Decodes the next value into its natural Go representation, as used for `any` targets. Integers become int64, or uint64 when they do not fit.
+func (d *cborDecoder) decodeAny() (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c & 0xe0 {
+	case cborMajorUint:
+		_, _, n, err := d.readHead()
+		if n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), err
+	case cborMajorNegInt:
+		_, _, n, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: negative integer -1-%d overflows int64", n)
+		}
+		return -1 - int64(n), nil
+	case cborMajorBytes:
+		s, err := d.decodeString(cborMajorBytes)
+		return append([]byte{}, s...), err
+	case cborMajorText:
+		s, err := d.decodeString(cborMajorText)
+		return string(s), err
+	case cborMajorArray:
+		n, err := d.decodeContainerHead(cborMajorArray)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case cborMajorMap:
+		return d.decodeAnyMap()
+	case cborMajorTag:
+		start := d.pos
+		_, _, tag, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if tag == cborTagDateTimeString || tag == cborTagEpochDateTime {
+			d.pos = start
+			return d.decodeTime()
+		}
+		return d.decodeAny()
+	}
+
+	switch c {
+	case cborFalse, cborTrue:
+		d.pos++
+		return c == cborTrue, nil
+	case cborNull, cborUndefined:
+		d.pos++
+		return nil, nil
+	case cborFloat16, cborFloat32, cborFloat64:
+		return d.decodeFloat()
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value 0x%02x", c)
+	}
+}
+
+func (d *cborDecoder) decodeAnyMap() (any, error) {
+	n, err := d.decodeContainerHead(cborMajorMap)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]any, n)
+	values := make([]any, n)
+	stringKeys := true
+	for i := 0; i < n; i++ {
+		if keys[i], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+		if values[i], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+		if _, ok := keys[i].(string); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]any, n)
+		for i := range keys {
+			m[keys[i].(string)] = values[i]
+		}
+		return m, nil
+	}
+
+	m := make(map[any]any, n)
+	for i := range keys {
+		if keys[i] != nil && !reflect.TypeOf(keys[i]).Comparable() {
+			return nil, fmt.Errorf("cbor: unsupported map key of type %T", keys[i])
+		}
+		m[keys[i]] = values[i]
+	}
+	return m, nil
+}
@@ -2,51 +2,450 @@ package onthewire
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
 	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
 	"io"
+	"math"
 )
 
+var (
+	ErrCompressionMismatch  = fmt.Errorf("compression algorithm does not match")
+	ErrDecompressedTooLarge = fmt.Errorf("decompressed data is too large")
+)
+
+// Compresses and decompresses the bytes passing through a pipeline. Use it with UseCompressionWith.
+//
+// ID identifies the algorithm on the wire so a reader can detect that a different one was used. IDs below 16 are reserved for the compressors in this package.
+type Compressor interface {
+	ID() byte
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type zlibCompressor struct {
+	level int
+}
+
+// Creates a compressor using `compress/zlib` at the given level, such as flate.BestSpeed or flate.BestCompression.
+func ZlibCompressor(level int) Compressor {
+	return zlibCompressor{level: level}
+}
+
+func (c zlibCompressor) ID() byte {
+	return 1
+}
+
+func (c zlibCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, c.level)
+}
+
+func (c zlibCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+// Creates a compressor using `compress/gzip` at the given level, such as flate.BestSpeed or flate.BestCompression.
+func GzipCompressor(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+func (c gzipCompressor) ID() byte {
+	return 2
+}
+
+func (c gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (c gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type flateCompressor struct {
+	level int
+}
+
+// Creates a compressor using raw DEFLATE from `compress/flate` at the given level. Without the zlib or gzip headers and checksums this is the smallest of the DEFLATE based formats.
+func FlateCompressor(level int) Compressor {
+	return flateCompressor{level: level}
+}
+
+func (c flateCompressor) ID() byte {
+	return 3
+}
+
+func (c flateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+func (c flateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type lzwCompressor struct{}
+
+// Creates a compressor using `compress/lzw` with LSB ordering and 8 bit literals, as used by GIF. LZW has no compression levels.
+func LZWCompressor() Compressor {
+	return lzwCompressor{}
+}
+
+func (c lzwCompressor) ID() byte {
+	return 4
+}
+
+func (c lzwCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return lzw.NewWriter(w, lzw.LSB, 8), nil
+}
+
+func (c lzwCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return lzw.NewReader(r, lzw.LSB, 8), nil
+}
+
+// Limits how much data is decompressed when passed to UseCompression or UseCompressionWith, so a small malicious payload cannot expand to exhaust the reader's memory.
+type DecompressionOption func(*decompressionLimits)
+
+type decompressionLimits struct {
+	maxSize  int64
+	maxRatio float64
+}
+
+// Causes decompression to fail with ErrDecompressedTooLarge if data would decompress to more than size bytes.
+func MaxDecompressedSize(size int64) DecompressionOption {
+	return func(l *decompressionLimits) {
+		l.maxSize = size
+	}
+}
+
+// Causes decompression to fail with ErrDecompressedTooLarge if data would decompress to more than ratio times its compressed size.
+func MaxCompressionRatio(ratio float64) DecompressionOption {
+	return func(l *decompressionLimits) {
+		l.maxRatio = ratio
+	}
+}
+
+func newDecompressionLimits(opts []DecompressionOption) decompressionLimits {
+	limits := decompressionLimits{}
+	for _, opt := range opts {
+		opt(&limits)
+	}
+	return limits
+}
+
+// Returns the most bytes compressedLen bytes may decompress to, or -1 if there is no limit.
+func (l decompressionLimits) limit(compressedLen int) int64 {
+	limit := int64(-1)
+	if l.maxSize > 0 {
+		limit = l.maxSize
+	}
+
+	if l.maxRatio > 0 {
+		byRatio := l.maxRatio * float64(compressedLen)
+		if byRatio < math.MaxInt64 && (limit < 0 || int64(byRatio) < limit) {
+			limit = int64(byRatio)
+		}
+	}
+
+	return limit
+}
+
+// Implemented by readers that know their uncompressed size before decompressing, so limits can be checked without doing the work.
+type sizedReader interface {
+	uncompressedSize() uint64
+}
+
+// Reports an error if c cannot create a writer, such as when it was given an invalid level.
+func checkCompressor(c Compressor) error {
+	w, err := c.NewWriter(io.Discard)
+	if err != nil {
+		return fmt.Errorf("compressor %d cannot be used: %w", c.ID(), err)
+	}
+	return w.Close()
+}
+
 func compress(data []byte) ([]byte, error) {
+	return compressBytes(ZlibCompressor(zlib.DefaultCompression), data)
+}
+
+func decompress(limits decompressionLimits) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return decompressBytes(ZlibCompressor(zlib.DefaultCompression), data, limits)
+	}
+}
+
+// Compresses with c, prefixing the compressor ID so the reader can check the same algorithm is used.
+func compressWith(c Compressor) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		compressed, err := compressBytes(c, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte{c.ID()}, compressed...), nil
+	}
+}
+
+// Decompresses data written by compressWith, returning ErrCompressionMismatch if it was compressed with a different compressor.
+func decompressWith(c Compressor, limits decompressionLimits) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		if len(data) == 0 {
+			logger.Error("Failed to decompress data. The compressor ID is missing", "Error", ErrCompressionMismatch)
+			return nil, ErrCompressionMismatch
+		}
+
+		if data[0] != c.ID() {
+			logger.Error("Failed to decompress data. The data was compressed with a different compressor", "ExpectedID", c.ID(), "ID", data[0])
+			return nil, fmt.Errorf("%w: compressed with %d, expected %d", ErrCompressionMismatch, data[0], c.ID())
+		}
+
+		return decompressBytes(c, data[1:], limits)
+	}
+}
+
+func compressBytes(c Compressor, data []byte) ([]byte, error) {
 	buffer := bytes.NewBuffer(nil)
 
 	uncompressedLen := len(data)
 
-	logger.Debug("Compressing...", "ByteCount", uncompressedLen)
-	compressor := zlib.NewWriter(buffer)
+	logger.Debug("Compressing...", "ByteCount", uncompressedLen, "CompressorID", c.ID())
+	compressor, err := c.NewWriter(buffer)
+	if err != nil {
+		logger.Error("Failed to create compressor", "Error", err)
+		return nil, err
+	}
+
 	if _, err := compressor.Write(data); err != nil {
 		logger.Error("Failed to compress data", "Error", err)
 		return nil, err
 	}
-	compressor.Close()
+
+	if err := compressor.Close(); err != nil {
+		logger.Error("Failed to complete compression", "Error", err)
+		return nil, err
+	}
 
 	compressedLen := len(buffer.Bytes())
 
 	logger.Debug("Successfully compressed", "ByteCount", compressedLen)
 
-	if compressedLen > uncompressedLen {
+	// Adaptive compression already stores data uncompressed when compressing doesn't help
+	if _, adaptive := c.(adaptiveCompressor); !adaptive && compressedLen > uncompressedLen {
 		logger.Warn("Compression resulted in an increase in total byte count. Consider that the data you are transferring is already small enough to avoid compression", "UncompressedByteCount", uncompressedLen, "CompressedByteCount", compressedLen)
 	}
 
 	return buffer.Bytes(), nil
 }
 
-func decompress(data []byte) ([]byte, error) {
-	buffer := bytes.NewBuffer(nil)
-
-	logger.Debug("Decompressing...")
-	byteReader := bytes.NewReader(data)
-	decompressor, err := zlib.NewReader(byteReader)
+// Decompresses data with c, stopping with ErrDecompressedTooLarge as soon as it exceeds limits.
+func decompressBytes(c Compressor, data []byte, limits decompressionLimits) ([]byte, error) {
+	logger.Debug("Decompressing...", "CompressorID", c.ID())
+	decompressor, err := c.NewReader(bytes.NewReader(data))
 	if err != nil {
 		logger.Error("Failed to decompress data", "Error", err)
 		return nil, err
 	}
 	defer decompressor.Close()
 
-	if _, err := io.Copy(buffer, decompressor); err != nil {
+	decompressed, err := readDecompressed(decompressor, len(data), limits)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Successfully decompressed", "ByteCount", len(decompressed))
+	return decompressed, nil
+}
+
+// Reads everything from decompressor, stopping with ErrDecompressedTooLarge as soon as it exceeds the limit for compressedLen bytes of compressed data.
+func readDecompressed(decompressor io.Reader, compressedLen int, limits decompressionLimits) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+
+	limit := limits.limit(compressedLen)
+
+	if sized, ok := decompressor.(sizedReader); ok && limit >= 0 && sized.uncompressedSize() > uint64(limit) {
+		logger.Error("Failed to decompress data. The uncompressed size exceeds the limit", "Size", sized.uncompressedSize(), "Limit", limit)
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrDecompressedTooLarge, sized.uncompressedSize(), limit)
+	}
+
+	// Read one byte past the limit to tell data that exceeds it from data that fits exactly
+	src := decompressor
+	if limit >= 0 {
+		src = io.LimitReader(decompressor, limit+1)
+	}
+
+	if _, err := io.Copy(buffer, src); err != nil {
 		logger.Error("Failed to copy decompressed data", "Error", err)
 		return nil, err
 	}
 
-	logger.Debug("Successfully decompressed", "ByteCount", len(buffer.Bytes()))
+	if limit >= 0 && int64(buffer.Len()) > limit {
+		logger.Error("Failed to decompress data. The decompressed data exceeds the limit", "CompressedByteCount", compressedLen, "Limit", limit)
+		return nil, fmt.Errorf("%w: exceeds the limit of %d bytes", ErrDecompressedTooLarge, limit)
+	}
+
 	return buffer.Bytes(), nil
 }
+
+var ErrCompressionFlag = fmt.Errorf("adaptive compression flag is invalid")
+
+const (
+	adaptiveStored     byte = 0
+	adaptiveCompressed byte = 1
+)
+
+type adaptiveCompressor struct {
+	compressor Compressor
+	minSize    int
+}
+
+// Creates a compressor that only uses c when it helps. Payloads smaller than minSize, or that c cannot make smaller, are stored uncompressed.
+//
+// A flag byte ahead of the data records whether it was compressed, so the reader only decompresses when needed. The ID is that of c with the top bit set, so c must have an ID below 128.
+func AdaptiveCompressor(c Compressor, minSize int) Compressor {
+	return adaptiveCompressor{compressor: c, minSize: minSize}
+}
+
+func (c adaptiveCompressor) ID() byte {
+	return 0x80 | c.compressor.ID()
+}
+
+func (c adaptiveCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if err := checkCompressor(c.compressor); err != nil {
+		return nil, err
+	}
+	return &adaptiveWriter{w: w, compressor: c.compressor, minSize: c.minSize}, nil
+}
+
+func (c adaptiveCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	flag := make([]byte, 1)
+	if _, err := io.ReadFull(r, flag); err != nil {
+		return nil, err
+	}
+
+	switch flag[0] {
+	case adaptiveStored:
+		logger.Debug("Adaptive compression flag shows data was stored uncompressed")
+		return io.NopCloser(r), nil
+	case adaptiveCompressed:
+		return c.compressor.NewReader(r)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrCompressionFlag, flag[0])
+	}
+}
+
+// Buffers the whole payload, since whether to compress it is only known once it has been compressed.
+type adaptiveWriter struct {
+	w          io.Writer
+	compressor Compressor
+	minSize    int
+	buffer     bytes.Buffer
+}
+
+func (a *adaptiveWriter) Write(p []byte) (int, error) {
+	return a.buffer.Write(p)
+}
+
+func (a *adaptiveWriter) Close() error {
+	data := a.buffer.Bytes()
+
+	if len(data) >= a.minSize {
+		compressed := bytes.NewBuffer([]byte{adaptiveCompressed})
+
+		compressor, err := a.compressor.NewWriter(compressed)
+		if err != nil {
+			return err
+		}
+		if _, err := compressor.Write(data); err != nil {
+			return err
+		}
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+
+		if compressed.Len()-1 < len(data) {
+			_, err := writeFull(a.w, compressed.Bytes())
+			return err
+		}
+		logger.Debug("Compression did not reduce the byte count, storing uncompressed", "ByteCount", len(data), "CompressedByteCount", compressed.Len()-1)
+	} else {
+		logger.Debug("Payload is below the minimum size for compression, storing uncompressed", "ByteCount", len(data), "MinSize", a.minSize)
+	}
+
+	if _, err := writeFull(a.w, []byte{adaptiveStored}); err != nil {
+		return err
+	}
+	_, err := writeFull(a.w, data)
+	return err
+}
+
+var ErrUnknownDictionary = fmt.Errorf("compression dictionary is unknown")
+
+type dictionaryCompressor struct {
+	level int
+	dicts map[uint32][]byte
+	first uint32
+}
+
+// Creates a compressor using `compress/zlib` with a preset dictionary, which greatly improves compression of small messages that share structure, such as JSON documents of the same type. Dictionaries can be built from sample messages with TrainDictionary.
+//
+// Messages are compressed with the first dictionary, whose ID zlib writes in the header of the compressed data. Readers can decompress with any of the dictionaries, so a new dictionary can be rolled out by adding it to the readers before putting it first on the writers.
+func DictionaryCompressor(level int, dicts ...[]byte) Compressor {
+	c := dictionaryCompressor{level: level, dicts: make(map[uint32][]byte)}
+	for i, dict := range dicts {
+		id := DictionaryID(dict)
+		if i == 0 {
+			c.first = id
+		}
+		c.dicts[id] = dict
+	}
+	return c
+}
+
+// Returns the ID written to the wire for dict, which is its Adler-32 checksum as written by zlib in the header of the compressed data.
+func DictionaryID(dict []byte) uint32 {
+	return adler32.Checksum(dict)
+}
+
+func (c dictionaryCompressor) ID() byte {
+	return 5
+}
+
+func (c dictionaryCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	dict, ok := c.dicts[c.first]
+	if !ok {
+		return nil, fmt.Errorf("%w: no dictionaries were given", ErrUnknownDictionary)
+	}
+
+	return zlib.NewWriterLevelDict(w, c.level, dict)
+}
+
+// The zlib header of data compressed with a preset dictionary is 2 bytes of flags followed by the dictionary ID.
+const zlibDictHeaderSize = 6
+
+func (c dictionaryCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	header := make([]byte, zlibDictHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	// zlib checks the rest of the header, but only once the dictionary has been picked
+	if header[1]&0x20 == 0 {
+		logger.Error("Failed to decompress data. No dictionary was used", "Error", ErrUnknownDictionary)
+		return nil, fmt.Errorf("%w: the data was not compressed with a dictionary", ErrUnknownDictionary)
+	}
+
+	id := binary.BigEndian.Uint32(header[2:])
+	dict, ok := c.dicts[id]
+	if !ok {
+		logger.Error("Failed to decompress data. The dictionary is unknown", "DictionaryID", id)
+		return nil, fmt.Errorf("%w: %08x", ErrUnknownDictionary, id)
+	}
+
+	return zlib.NewReaderDict(io.MultiReader(bytes.NewReader(header), r), dict)
+}
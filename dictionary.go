@@ -0,0 +1,118 @@
+package onthewire
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+const (
+	// The largest dictionary zlib can make use of, since it is limited to its 32KB window.
+	maxDictionarySize = 32 * 1024
+	dictionaryNGram   = 8
+)
+
+// Encodes each sample value with encode and builds a dictionary of at most maxSize bytes from the results with BuildDictionary.
+//
+// encode should produce the same bytes the pipeline's encoder does, such as json.Marshal for JSON encoding.
+func TrainDictionary[T any](samples []T, encode func(T) ([]byte, error), maxSize int) ([]byte, error) {
+	encoded := make([][]byte, 0, len(samples))
+	for _, sample := range samples {
+		data, err := encode(sample)
+		if err != nil {
+			logger.Error("Failed to encode sample for dictionary", "Error", err)
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+
+	return BuildDictionary(encoded, maxSize), nil
+}
+
+// Builds a preset dictionary of at most maxSize bytes for use with DictionaryCompressor from sample messages.
+//
+// The dictionary is made of the substrings shared by the samples, such as field names and common values, with the most valuable placed last where they are cheapest for zlib to refer to. A maxSize of zero or more than 32KB uses 32KB, the most zlib can use. The result is deterministic, so every service building a dictionary from the same samples gets the same one.
+func BuildDictionary(samples [][]byte, maxSize int) []byte {
+	if maxSize <= 0 || maxSize > maxDictionarySize {
+		maxSize = maxDictionarySize
+	}
+
+	// Count how many samples each n-gram appears in
+	ngrams := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+dictionaryNGram <= len(sample); i++ {
+			ngram := string(sample[i : i+dictionaryNGram])
+			if !seen[ngram] {
+				seen[ngram] = true
+				ngrams[ngram]++
+			}
+		}
+	}
+
+	threshold := max(2, len(samples)/10)
+	isCommon := func(sample []byte, i int) bool {
+		return ngrams[string(sample[i:i+dictionaryNGram])] >= threshold
+	}
+
+	// Join overlapping common n-grams into the longest shared substrings and count the samples they appear in
+	segments := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+dictionaryNGram <= len(sample); {
+			if !isCommon(sample, i) {
+				i++
+				continue
+			}
+
+			start := i
+			for i+dictionaryNGram <= len(sample) && isCommon(sample, i) {
+				i++
+			}
+
+			segment := string(sample[start : i+dictionaryNGram-1])
+			if !seen[segment] {
+				seen[segment] = true
+				segments[segment]++
+			}
+		}
+	}
+
+	type scoredSegment struct {
+		segment string
+		score   int
+	}
+
+	scored := make([]scoredSegment, 0, len(segments))
+	for segment, count := range segments {
+		scored = append(scored, scoredSegment{segment: segment, score: count * len(segment)})
+	}
+	slices.SortFunc(scored, func(a, b scoredSegment) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.segment, b.segment)
+	})
+
+	// Take the best segments first, then reverse them so the best end up closest to the data
+	chosen := make([]string, 0)
+	size := 0
+	joined := strings.Builder{}
+	for _, s := range scored {
+		if size+len(s.segment) > maxSize {
+			continue
+		}
+		if strings.Contains(joined.String(), s.segment) {
+			continue
+		}
+
+		chosen = append(chosen, s.segment)
+		joined.WriteString(s.segment)
+		size += len(s.segment)
+	}
+	slices.Reverse(chosen)
+
+	dict := []byte(strings.Join(chosen, ""))
+	logger.Debug("Built compression dictionary", "ByteCount", len(dict), "SampleCount", len(samples), "SegmentCount", len(chosen))
+	return dict
+}
@@ -0,0 +1,62 @@
+package onthewire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var ErrNoHandler = fmt.Errorf("no handler for message type")
+
+// Routes messages to handlers based on their concrete type. This pairs with UseTypeRegistry, where the read func returns many different types behind an interface.
+type Dispatcher struct {
+	handlers map[reflect.Type]func(any) error
+}
+
+// Creates a dispatcher with no handlers.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[reflect.Type]func(any) error),
+	}
+}
+
+// Registers the handler for messages of type M, replacing any previously registered for M.
+func Handle[M any](d *Dispatcher, handler func(M) error) *Dispatcher {
+	d.handlers[reflect.TypeFor[M]()] = func(msg any) error {
+		return handler(msg.(M))
+	}
+	return d
+}
+
+// Calls the handler registered for the concrete type of msg, returning the handler's error or ErrNoHandler if there isn't one.
+func (d *Dispatcher) Dispatch(msg any) error {
+	typ := reflect.TypeOf(msg)
+	handler, ok := d.handlers[typ]
+	if !ok {
+		logger.Error("Failed to dispatch message. No handler is registered", "Type", typ)
+		return fmt.Errorf("%w: %v", ErrNoHandler, typ)
+	}
+
+	logger.Debug("Dispatching message", "Type", typ)
+	return handler(msg)
+}
+
+// Reads messages from r and dispatches each of them until reading or a handler fails.
+//
+// Serve returns nil once r is exhausted, otherwise the error that stopped it.
+func Serve[T any](d *Dispatcher, read func(io.Reader) (T, error), r io.Reader) error {
+	for {
+		msg, err := read(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := d.Dispatch(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package onthewire
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var ErrFieldKeyUnavailable = fmt.Errorf("no key available for field encryption")
+
+// Passes the value of a field through a cipher. The path of the field is given as additional data, binding the ciphertext to the field it was written for where the cipher supports it.
+type fieldCrypt func(data []byte, path []byte) ([]byte, error)
+
+// Returns the cipher used for the fields of a single message, or false if no key is available.
+type fieldCipher func() (fieldCrypt, bool)
+
+// RSA encryption has no additional data, so the path of each field is not bound to its ciphertext.
+func asymmetricFieldEncrypter(publicKeyFn func() *rsa.PublicKey) fieldCipher {
+	return func() (fieldCrypt, bool) {
+		publicKey := publicKeyFn()
+		if publicKey == nil {
+			return nil, false
+		}
+		encrypt := asymmetricEncrypt(func() *rsa.PublicKey { return publicKey })
+		return func(data []byte, _ []byte) ([]byte, error) { return encrypt(data) }, true
+	}
+}
+
+func asymmetricFieldDecrypter(privateKeyFn func() *rsa.PrivateKey) fieldCipher {
+	return func() (fieldCrypt, bool) {
+		privateKey := privateKeyFn()
+		if privateKey == nil {
+			return nil, false
+		}
+		decrypt := asymmetricDecrypt(func() *rsa.PrivateKey { return privateKey })
+		return func(data []byte, _ []byte) ([]byte, error) { return decrypt(data) }, true
+	}
+}
+
+func symmetricFieldCipher(keyFn func() []byte, crypt func([]byte) func([]byte, []byte) ([]byte, error)) fieldCipher {
+	return func() (fieldCrypt, bool) {
+		key := keyFn()
+		if len(key) == 0 {
+			return nil, false
+		}
+		return crypt(key), true
+	}
+}
+
+type fieldCryptKind int
+
+const (
+	fieldCryptString fieldCryptKind = iota
+	fieldCryptBytes
+	fieldCryptNested
+)
+
+// Describes where the fields tagged with `otw:"encrypt"` are within a struct type, including those within nested structs and the elements of slices, arrays and maps.
+//
+// Fields listed as nested may hold tagged fields, such as interfaces whose values are only known when writing, while tagged records whether any tags were found.
+type fieldCryptPlan struct {
+	fields []fieldCryptField
+	tagged bool
+	err    error
+}
+
+type fieldCryptField struct {
+	index int
+	kind  fieldCryptKind
+}
+
+var fieldCryptPlanCache sync.Map
+
+func fieldCryptPlanFor(t reflect.Type) *fieldCryptPlan {
+	if cached, ok := fieldCryptPlanCache.Load(t); ok {
+		return cached.(*fieldCryptPlan)
+	}
+
+	plan := newFieldCryptPlan(t, make(map[reflect.Type]*fieldCryptPlan))
+	fieldCryptPlanCache.Store(t, plan)
+	return plan
+}
+
+func newFieldCryptPlan(t reflect.Type, building map[reflect.Type]*fieldCryptPlan) *fieldCryptPlan {
+	if plan, ok := building[t]; ok {
+		return plan
+	}
+
+	plan := &fieldCryptPlan{}
+	building[t] = plan
+	defer delete(building, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if hasOTWOption(f, "encrypt") {
+			switch {
+			case !f.IsExported():
+				plan.err = fmt.Errorf("field encryption: %s.%s is unexported and cannot be encrypted", t, f.Name)
+			case f.Type.Kind() == reflect.String:
+				plan.fields = append(plan.fields, fieldCryptField{index: i, kind: fieldCryptString})
+			case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Uint8:
+				plan.fields = append(plan.fields, fieldCryptField{index: i, kind: fieldCryptBytes})
+			default:
+				plan.err = fmt.Errorf("field encryption: %s.%s has type %s, only string and []byte fields can be encrypted", t, f.Name, f.Type)
+			}
+
+			if plan.err != nil {
+				return plan
+			}
+			plan.tagged = true
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		nested, tagged, err := planFieldCryptType(f.Type, building)
+		if err != nil {
+			plan.err = err
+			return plan
+		}
+		if nested {
+			plan.fields = append(plan.fields, fieldCryptField{index: i, kind: fieldCryptNested})
+		}
+		plan.tagged = plan.tagged || tagged
+	}
+
+	return plan
+}
+
+// Reports whether values of t may hold fields tagged with `otw:"encrypt"`, and whether any tags were found, looking through pointers, slices, arrays and maps to the structs within.
+//
+// Interfaces may hold anything so are always looked into when writing. Map keys cannot be changed in place, so fail if they have tagged fields.
+func planFieldCryptType(t reflect.Type, building map[reflect.Type]*fieldCryptPlan) (bool, bool, error) {
+	switch t.Kind() {
+	case reflect.Struct:
+		// Recursive types are still being planned, so are assumed to have encrypted fields
+		if _, recursive := building[t]; recursive {
+			return true, false, nil
+		}
+
+		plan := newFieldCryptPlan(t, building)
+		return len(plan.fields) > 0, plan.tagged, plan.err
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		// Container types can refer to themselves without a struct in between, such as type T []T
+		if _, recursive := building[t]; recursive {
+			return true, false, nil
+		}
+		building[t] = nil
+		defer delete(building, t)
+
+		if t.Kind() == reflect.Map {
+			_, tagged, err := planFieldCryptType(t.Key(), building)
+			if err != nil {
+				return false, false, err
+			}
+			if tagged {
+				return false, false, fmt.Errorf("field encryption: %s has keys with encrypted fields, which cannot be encrypted", t)
+			}
+		}
+
+		return planFieldCryptType(t.Elem(), building)
+	case reflect.Interface:
+		return true, false, nil
+	default:
+		return false, false, nil
+	}
+}
+
+// The result of planFieldCryptType for a type, cached so that values are only looked into when they may hold tagged fields.
+type fieldCryptType struct {
+	nested bool
+	tagged bool
+	err    error
+}
+
+var fieldCryptTypeCache sync.Map
+
+func fieldCryptTypeFor(t reflect.Type) fieldCryptType {
+	if cached, ok := fieldCryptTypeCache.Load(t); ok {
+		return cached.(fieldCryptType)
+	}
+
+	var c fieldCryptType
+	c.nested, c.tagged, c.err = planFieldCryptType(t, make(map[reflect.Type]*fieldCryptPlan))
+	fieldCryptTypeCache.Store(t, c)
+	return c
+}
+
+// Checks that the fields tagged with `otw:"encrypt"` in t can be encrypted, returning whether there are any.
+func checkFieldEncryption(t reflect.Type) (bool, error) {
+	c := fieldCryptTypeFor(t)
+	return c.tagged, c.err
+}
+
+// Returns a copy of t with each field tagged with `otw:"encrypt"` passed through crypt. The original value, including anything it points to, is left untouched.
+//
+// Strings are Base64 encoded once encrypted, so they remain valid strings for every encoding.
+func cryptFields[T any](t T, crypt fieldCrypt, encrypt bool) (T, error) {
+	v := reflect.ValueOf(t)
+	if !v.IsValid() {
+		return t, nil
+	}
+
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	if err := cryptFieldValue(copied, "", crypt, encrypt); err != nil {
+		return *new(T), err
+	}
+
+	return copied.Interface().(T), nil
+}
+
+// Passes the tagged fields within v through crypt, replacing v with copies of anything it refers to rather than changing what the caller shares. Values without tagged fields are left as they are.
+//
+// The path is made of the names of the fields leading to v from the value being written, such as "Credentials.Token". Elements of slices, arrays and maps share the path of the field holding them.
+func cryptFieldValue(v reflect.Value, path string, crypt fieldCrypt, encrypt bool) error {
+	if v.Kind() == reflect.Struct {
+		plan := fieldCryptPlanFor(v.Type())
+		if plan.err != nil {
+			return plan.err
+		}
+		return cryptStructFields(v, plan, path, crypt, encrypt)
+	}
+
+	if c := fieldCryptTypeFor(v.Type()); c.err != nil || !c.nested {
+		return c.err
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(v.Elem())
+		if err := cryptFieldValue(copied.Elem(), path, crypt, encrypt); err != nil {
+			return err
+		}
+		v.Set(copied)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := 0; i < copied.Len(); i++ {
+			if err := cryptFieldValue(copied.Index(i), path, crypt, encrypt); err != nil {
+				return err
+			}
+		}
+		v.Set(copied)
+	case reflect.Array:
+		// Arrays are values, so v is already a copy
+		for i := 0; i < v.Len(); i++ {
+			if err := cryptFieldValue(v.Index(i), path, crypt, encrypt); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := cryptFieldValue(elem, path, crypt, encrypt); err != nil {
+				return err
+			}
+			copied.SetMapIndex(iter.Key(), elem)
+		}
+		v.Set(copied)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := cryptFieldValue(elem, path, crypt, encrypt); err != nil {
+			return err
+		}
+		v.Set(elem)
+	}
+
+	return nil
+}
+
+func cryptStructFields(v reflect.Value, plan *fieldCryptPlan, path string, crypt fieldCrypt, encrypt bool) error {
+	for _, f := range plan.fields {
+		field := v.Field(f.index)
+
+		fieldPath := v.Type().Field(f.index).Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		switch f.kind {
+		case fieldCryptString:
+			data := []byte(field.String())
+			if !encrypt {
+				decoded, err := base64.StdEncoding.DecodeString(field.String())
+				if err != nil {
+					logger.Error("Failed to decode encrypted field", "Field", fieldPath, "Error", err)
+					return err
+				}
+				data = decoded
+			}
+
+			crypted, err := crypt(data, []byte(fieldPath))
+			if err != nil {
+				return err
+			}
+
+			if encrypt {
+				field.SetString(base64.StdEncoding.EncodeToString(crypted))
+			} else {
+				field.SetString(string(crypted))
+			}
+		case fieldCryptBytes:
+			crypted, err := crypt(field.Bytes(), []byte(fieldPath))
+			if err != nil {
+				return err
+			}
+			field.SetBytes(crypted)
+		default:
+			if err := cryptFieldValue(field, fieldPath, crypt, encrypt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Wraps encoder to encrypt the fields tagged with `otw:"encrypt"` before encoding. Writing fails with ErrFieldKeyUnavailable rather than sending the fields unencrypted when there is no key.
+func fieldEncryptEncoder[W any](newCipher fieldCipher, encoder func(W) ([]byte, error)) func(W) ([]byte, error) {
+	return func(t W) ([]byte, error) {
+		crypt, ok := newCipher()
+		if !ok {
+			logger.Error("Failed to encrypt fields", "Error", ErrFieldKeyUnavailable)
+			return nil, ErrFieldKeyUnavailable
+		}
+
+		encrypted, err := cryptFields(t, crypt, true)
+		if err != nil {
+			logger.Error("Failed to encrypt fields", "Error", err)
+			return nil, err
+		}
+
+		return encoder(encrypted)
+	}
+}
+
+// Wraps decoder to decrypt the fields tagged with `otw:"encrypt"` after decoding. When there is no key the fields are left as they were received.
+func fieldDecryptDecoder[R any](newCipher fieldCipher, decoder func([]byte) (R, error)) func([]byte) (R, error) {
+	return func(data []byte) (R, error) {
+		t, err := decoder(data)
+		if err != nil {
+			return t, err
+		}
+
+		crypt, ok := newCipher()
+		if !ok {
+			logger.Debug("No key available for field decryption, leaving fields encrypted")
+			return t, nil
+		}
+
+		decrypted, err := cryptFields(t, crypt, false)
+		if err != nil {
+			logger.Error("Failed to decrypt fields", "Error", err)
+			return *new(R), err
+		}
+
+		return decrypted, nil
+	}
+}
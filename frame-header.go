@@ -0,0 +1,223 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrPipelineMismatch = fmt.Errorf("pipeline does not match")
+
+var frameMagic = []byte("OTW")
+
+const (
+	frameHeaderVersion byte = 1
+	// Magic, version, codec, flags and the number of operations
+	frameHeaderFixedLen = 7
+	maxFrameOperations  = 255
+)
+
+// Identifies the encoding of a message in a frame header. Encodings that can read each other's messages, such as JSON and canonical JSON, share an ID.
+const (
+	codecGob byte = iota + 1
+	codecGobStream
+	codecRaw
+	codecJSON
+	codecMarshaler
+	codecXML
+	codecMsgPack
+	codecCBOR
+	codecBinaryBigEndian
+	codecBinaryLittleEndian
+)
+
+var codecNames = map[byte]string{
+	codecGob:                "Gob",
+	codecGobStream:          "Gob stream",
+	codecRaw:                "Raw",
+	codecJSON:               "JSON",
+	codecMarshaler:          "Marshaler",
+	codecXML:                "XML",
+	codecMsgPack:            "MessagePack",
+	codecCBOR:               "CBOR",
+	codecBinaryBigEndian:    "big endian Binary",
+	codecBinaryLittleEndian: "little endian Binary",
+}
+
+// Returns the codec ID of binary encoding with order. Byte orders other than those in `encoding/binary` are identified by how they order bytes.
+func binaryCodec(order binary.ByteOrder) byte {
+	if order.Uint16([]byte{0, 1}) == 1 {
+		return codecBinaryBigEndian
+	}
+	return codecBinaryLittleEndian
+}
+
+func codecName(codec byte) string {
+	if name, ok := codecNames[codec]; ok {
+		return name + " encoding"
+	}
+	return fmt.Sprintf("unknown encoding %d", codec)
+}
+
+// Flags in a frame header for steps of encoding that change the encoded bytes.
+const (
+	frameFlagSchema byte = 1 << iota
+	frameFlagTypeRegistry
+)
+
+// Kinds of operation in a frame header.
+const (
+	operationCustom byte = iota + 1
+	operationCompression
+	operationCompressionWith
+	operationStreamCompression
+	operationAsymmetricEncryption
+	operationSigning
+	operationNonce
+)
+
+var operationNames = map[byte]string{
+	operationCustom:               "custom",
+	operationCompression:          "compression",
+	operationCompressionWith:      "compression",
+	operationStreamCompression:    "stream compression",
+	operationAsymmetricEncryption: "asymmetric encryption",
+	operationSigning:              "signing",
+	operationNonce:                "nonce",
+}
+
+// Identifies an operation in a frame header. The read and write steps of an operation share a code, and compressorID tells apart compressors used with UseCompressionWith.
+type operationCode struct {
+	kind         byte
+	compressorID byte
+}
+
+func (c operationCode) String() string {
+	name, ok := operationNames[c.kind]
+	if !ok {
+		name = fmt.Sprintf("unknown %d", c.kind)
+	}
+	if c.kind == operationCompressionWith {
+		return fmt.Sprintf("%s with compressor %d", name, c.compressorID)
+	}
+	return name
+}
+
+func describeOperations(operations []operationCode) string {
+	names := make([]string, len(operations))
+	for i, operation := range operations {
+		names[i] = operation.String()
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// Describes how a message was written, so a reader can confirm it reads messages the same way.
+type frameHeader struct {
+	codec      byte
+	flags      byte
+	operations []operationCode
+}
+
+func newFrameHeader(codec byte, flags byte, operations []pipelineOperation) (frameHeader, error) {
+	if len(operations) > maxFrameOperations {
+		return frameHeader{}, fmt.Errorf("frame header cannot describe %d operations, at most %d can be used", len(operations), maxFrameOperations)
+	}
+
+	h := frameHeader{codec: codec, flags: flags, operations: make([]operationCode, len(operations))}
+	for i, operation := range operations {
+		h.operations[i] = operation.code
+	}
+	return h, nil
+}
+
+// Returns the header as written ahead of each message: the magic bytes, version, codec, flags, number of operations and the kind and compressor ID of each operation.
+func (h frameHeader) bytes() []byte {
+	b := make([]byte, 0, frameHeaderFixedLen+2*len(h.operations))
+	b = append(b, frameMagic...)
+	b = append(b, frameHeaderVersion, h.codec, h.flags, byte(len(h.operations)))
+	for _, operation := range h.operations {
+		b = append(b, operation.kind, operation.compressorID)
+	}
+	return b
+}
+
+// Reads the frame header from the start of data, returning it and the rest of the message.
+func readFrameHeader(data []byte) (frameHeader, []byte, error) {
+	if len(data) < len(frameMagic) || !bytes.Equal(data[:len(frameMagic)], frameMagic) {
+		return frameHeader{}, nil, fmt.Errorf("%w: message has no frame header", ErrPipelineMismatch)
+	}
+
+	if len(data) < frameHeaderFixedLen {
+		return frameHeader{}, nil, fmt.Errorf("%w: frame header is truncated", ErrPipelineMismatch)
+	}
+
+	if version := data[3]; version != frameHeaderVersion {
+		return frameHeader{}, nil, fmt.Errorf("%w: frame header version %d is not supported, expected %d", ErrPipelineMismatch, version, frameHeaderVersion)
+	}
+
+	h := frameHeader{codec: data[4], flags: data[5]}
+	count := int(data[6])
+	data = data[frameHeaderFixedLen:]
+
+	if len(data) < 2*count {
+		return frameHeader{}, nil, fmt.Errorf("%w: frame header is truncated", ErrPipelineMismatch)
+	}
+
+	h.operations = make([]operationCode, count)
+	for i := range h.operations {
+		h.operations[i] = operationCode{kind: data[2*i], compressorID: data[2*i+1]}
+	}
+
+	return h, data[2*count:], nil
+}
+
+// Returns ErrPipelineMismatch describing every difference if a message written as described by written cannot be read as described by h.
+func (h frameHeader) check(written frameHeader) error {
+	differences := make([]string, 0)
+
+	if written.codec != h.codec {
+		differences = append(differences, fmt.Sprintf("written with %s, read with %s", codecName(written.codec), codecName(h.codec)))
+	}
+
+	flags := []struct {
+		flag byte
+		name string
+	}{
+		{frameFlagSchema, "schema versions"},
+		{frameFlagTypeRegistry, "a type registry"},
+	}
+	for _, f := range flags {
+		if written.flags&f.flag != 0 && h.flags&f.flag == 0 {
+			differences = append(differences, fmt.Sprintf("written with %s, read without", f.name))
+		} else if written.flags&f.flag == 0 && h.flags&f.flag != 0 {
+			differences = append(differences, fmt.Sprintf("written without %s, read with", f.name))
+		}
+	}
+
+	if !slices.Equal(written.operations, h.operations) {
+		differences = append(differences, fmt.Sprintf("written with operations %s, read with %s", describeOperations(written.operations), describeOperations(h.operations)))
+	}
+
+	if len(differences) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPipelineMismatch, strings.Join(differences, "; "))
+}
+
+// Strips the frame header from data, returning ErrPipelineMismatch if the message was not written as described by expected.
+func checkFrameHeader(expected frameHeader, data []byte) ([]byte, error) {
+	written, data, err := readFrameHeader(data)
+	if err != nil {
+		logger.Error("Failed to read frame header", "Error", err)
+		return nil, err
+	}
+
+	if err := expected.check(written); err != nil {
+		logger.Error("Failed to read message. The pipeline does not match the writer", "Error", err)
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,186 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrMessageTooLarge = fmt.Errorf("message is too large")
+	ErrFramingMismatch = fmt.Errorf("message framing does not match")
+)
+
+const (
+	defaultChunkSize = 1024
+	// Keeping chunks below 2^24 bytes means a fixed length always starts with a zero byte, which tells it apart from varintFrameMarker
+	maxChunkSize           = 1<<24 - 1
+	varintFrameMarker byte = 0xff
+)
+
+// Reports an error if n cannot be used as a chunk size.
+func checkChunkSize(n int) error {
+	if n < 1 || n > maxChunkSize {
+		return fmt.Errorf("chunk size %d must be between 1 and %d", n, maxChunkSize)
+	}
+	return nil
+}
+
+func appendFixedLength(b []byte, n int) []byte {
+	return binary.BigEndian.AppendUint32(b, uint32(n))
+}
+
+func appendVarintLength(b []byte, n int) []byte {
+	return binary.AppendUvarint(b, uint64(n))
+}
+
+// Creates the func that writes a whole message to w as length-value chunks of up to chunkSize bytes, followed by an empty chunk marking the end of the message.
+//
+// Lengths are 4 byte big endian, or unsigned varints preceded by varintFrameMarker if varintLengths is set. Each chunk is passed to write in a single call, with the empty chunk joining the last.
+func writeChunked(write func([]byte, io.Writer) (int, error), chunkSize int, varintLengths bool) func([]byte, io.Writer) error {
+	appendLength := appendFixedLength
+	if varintLengths {
+		appendLength = appendVarintLength
+	}
+
+	return func(data []byte, w io.Writer) error {
+		chunk := make([]byte, 0, min(len(data), chunkSize)+2*binary.MaxVarintLen32+1)
+		if varintLengths {
+			chunk = append(chunk, varintFrameMarker)
+		}
+
+		logger.Debug("Beginning chunked writes...", "ChunkSize", chunkSize)
+		for start := 0; ; start += chunkSize {
+			end := min(start+chunkSize, len(data))
+
+			chunk = appendLength(chunk, end-start)
+			chunk = append(chunk, data[start:end]...)
+
+			last := end == len(data)
+			if last && end > start {
+				// Write empty chunk to indicate to stop buffering
+				chunk = appendLength(chunk, 0)
+			}
+
+			written, err := write(chunk, w)
+			if err != nil {
+				logger.Error("Failed to write chunk", "Error", err)
+				return err
+			}
+			logger.Debug("Written bytes", "ByteCount", written)
+
+			if last {
+				return nil
+			}
+			chunk = chunk[:0]
+		}
+	}
+}
+
+// Creates the func that reads a whole message written by writeChunked from r. rlv reads each chunk, given the most bytes it may hold, which is negative when maxSize is zero or less and there is no limit, and whether it is the first chunk of the message.
+//
+// io.EOF is only returned if r ends before the message starts. Ending part way through a message, even between chunks, is io.ErrUnexpectedEOF.
+func readChunked(rlv func(io.Reader, int, bool) ([]byte, int, error), maxSize int) func(io.Reader) ([]byte, error) {
+	return func(r io.Reader) ([]byte, error) {
+		buffer := bytes.NewBuffer(nil)
+
+		logger.Debug("Beginning to read chunks...")
+		for chunks := 0; ; chunks++ {
+			remaining := -1
+			if maxSize > 0 {
+				remaining = maxSize - buffer.Len()
+			}
+
+			bufferSection, n, err := rlv(r, remaining, chunks == 0)
+			if err == io.EOF && chunks > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				logger.Error("Failed to read chunk", "Error", err)
+				return nil, err
+			}
+
+			if len(bufferSection) == 0 {
+				break
+			}
+
+			buffer.Write(bufferSection)
+			logger.Debug("Read chunk bytes", "ByteCount", n)
+		}
+
+		return buffer.Bytes(), nil
+	}
+}
+
+// Reads one chunk of a message written by writeChunked, holding at most limit bytes. Fails with ErrFramingMismatch if the chunk was written with the other kind of length, or has a length no writer would use.
+//
+// A length over the limit always fails with ErrMessageTooLarge, wrapping ErrFramingMismatch as well if the length is also one no writer would use.
+func readChunk(r io.Reader, limit int, varintLengths bool, first bool) ([]byte, int, error) {
+	var dataSize uint64
+	var count int
+	var mismatch error
+
+	if varintLengths {
+		br, ok := r.(io.ByteReader)
+		if !ok {
+			br = &singleByteReader{r: r}
+		}
+
+		if first {
+			marker, err := br.ReadByte()
+			if err != nil {
+				return nil, 0, err
+			}
+			count++
+
+			if marker != varintFrameMarker {
+				logger.Error("Failed to read chunk. The message was not written with varint lengths", "Error", ErrFramingMismatch)
+				return nil, count, fmt.Errorf("%w: expected varint lengths", ErrFramingMismatch)
+			}
+		}
+
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			if err == io.EOF && first {
+				err = io.ErrUnexpectedEOF
+			} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%w: %w", ErrFramingMismatch, err)
+			}
+			return nil, count, err
+		}
+		dataSize = size
+		count += len(binary.AppendUvarint(nil, size))
+	} else {
+		sizeBytes := make([]byte, 4)
+		if n, err := io.ReadFull(r, sizeBytes); err != nil {
+			return nil, n, err
+		}
+		count += 4
+
+		dataSize = uint64(binary.BigEndian.Uint32(sizeBytes))
+		if sizeBytes[0] != 0 {
+			mismatch = fmt.Errorf("%w: expected fixed lengths", ErrFramingMismatch)
+		}
+	}
+
+	if mismatch == nil && dataSize > maxChunkSize {
+		mismatch = fmt.Errorf("%w: chunk length %d exceeds %d", ErrFramingMismatch, dataSize, maxChunkSize)
+	}
+
+	if limit >= 0 && dataSize > uint64(limit) {
+		logger.Error("Failed to read chunk. The length exceeds the limit", "ByteCount", dataSize, "Limit", limit)
+		if mismatch != nil {
+			return nil, count, fmt.Errorf("%w: %d bytes exceeds the limit of %d: %w", ErrMessageTooLarge, dataSize, limit, mismatch)
+		}
+		return nil, count, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrMessageTooLarge, dataSize, limit)
+	}
+
+	if mismatch != nil {
+		logger.Error("Failed to read chunk. The length is not one written by a matching writer", "Error", mismatch)
+		return nil, count, mismatch
+	}
+
+	data, n, err := readValue(r, int(dataSize), limit)
+	return data, count + n, err
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"reflect"
+	"sync"
 )
 
 func gobEncode[T any](t T) ([]byte, error) {
@@ -15,19 +16,68 @@ func gobEncode[T any](t T) ([]byte, error) {
 		return nil, err
 	}
 
-	logger.Debug("Gob encoded", "Type", reflect.TypeOf(t), "ByteCount", len(buffer.Bytes()), "Bytes", buffer.Bytes())
+	logger.Debug("Gob encoded", "Type", reflect.TypeOf(t), "ByteCount", len(buffer.Bytes()), "Bytes", logBytes(buffer.Bytes(), reflect.TypeOf(t)))
 	return buffer.Bytes(), nil
 }
 
 func gobDecode[T any](data []byte) (T, error) {
-	gobber := gob.NewDecoder(bytes.NewReader(data))
-
 	t := *new(T)
-	if err := gobber.Decode(&t); err != nil {
+	if err := gobUnmarshal(data, &t); err != nil {
 		logger.Error("Failed to Gob decode", "Error", err)
 		return t, err
 	}
 
-	logger.Debug("Gob decoded", "Type", reflect.TypeOf(t), "Instance", t)
+	logger.Debug("Gob decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
 	return t, nil
 }
+
+func gobUnmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Creates an encoder that keeps its gob.Encoder between messages, so type descriptors are only sent with the first message.
+func gobStreamEncoder[T any]() func(T) ([]byte, error) {
+	var mu sync.Mutex
+	buffer := bytes.NewBuffer(nil)
+	gobber := gob.NewEncoder(buffer)
+
+	return func(t T) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		buffer.Reset()
+		if err := gobber.Encode(t); err != nil {
+			logger.Error("Failed to Gob stream encode", "Error", err)
+			return nil, err
+		}
+
+		encoded := bytes.Clone(buffer.Bytes())
+
+		logger.Debug("Gob stream encoded", "Type", reflect.TypeOf(t), "ByteCount", len(encoded), "Bytes", logBytes(encoded, reflect.TypeOf(t)))
+		return encoded, nil
+	}
+}
+
+// Creates a decoder that keeps its gob.Decoder between messages, so type descriptors received with earlier messages are remembered.
+func gobStreamDecoder[T any]() func([]byte) (T, error) {
+	var mu sync.Mutex
+	buffer := bytes.NewBuffer(nil)
+	gobber := gob.NewDecoder(buffer)
+
+	return func(data []byte) (T, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		buffer.Reset()
+		buffer.Write(data)
+
+		t := *new(T)
+		if err := gobber.Decode(&t); err != nil {
+			logger.Error("Failed to Gob stream decode", "Error", err)
+			return t, err
+		}
+
+		logger.Debug("Gob stream decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
+		return t, nil
+	}
+}
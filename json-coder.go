@@ -3,9 +3,54 @@ package onthewire
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"reflect"
 )
 
+var (
+	ErrJSONTrailingData = fmt.Errorf("unexpected data after JSON value")
+	ErrJSONTooDeep      = fmt.Errorf("JSON exceeds maximum nesting depth")
+)
+
+// Configures how JSON is decoded when passed to UseJSONEncoding.
+type JSONOption func(*jsonOptions)
+
+type jsonOptions struct {
+	disallowUnknownFields bool
+	useNumber             bool
+	rejectTrailingData    bool
+	maxDepth              int
+}
+
+// Causes decoding to fail when an object has a key that does not match a field of the destination struct.
+func JSONDisallowUnknownFields() JSONOption {
+	return func(o *jsonOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// Causes numbers decoded into `any` fields to be a json.Number instead of a float64, so no precision is lost.
+func JSONUseNumber() JSONOption {
+	return func(o *jsonOptions) {
+		o.useNumber = true
+	}
+}
+
+// Causes decoding to fail with ErrJSONTrailingData if anything other than whitespace follows the JSON value.
+func JSONRejectTrailingData() JSONOption {
+	return func(o *jsonOptions) {
+		o.rejectTrailingData = true
+	}
+}
+
+// Causes decoding to fail with ErrJSONTooDeep if objects and arrays are nested deeper than depth.
+func JSONMaxDepth(depth int) JSONOption {
+	return func(o *jsonOptions) {
+		o.maxDepth = depth
+	}
+}
+
 func jsonEncode[T any](t T) ([]byte, error) {
 	buffer := bytes.NewBuffer(nil)
 
@@ -15,19 +60,105 @@ func jsonEncode[T any](t T) ([]byte, error) {
 		return nil, err
 	}
 
-	logger.Debug("JSON encoded", "Type", reflect.TypeOf(t), "ByteCount", len(buffer.Bytes()), "Bytes", buffer.Bytes())
+	logger.Debug("JSON encoded", "Type", reflect.TypeOf(t), "ByteCount", len(buffer.Bytes()), "Bytes", logBytes(buffer.Bytes(), reflect.TypeOf(t)))
 	return buffer.Bytes(), nil
 }
 
 func jsonDecode[T any](data []byte) (T, error) {
-	jsonifier := json.NewDecoder(bytes.NewReader(data))
+	return jsonDecodeWithOptions[T](data, jsonOptions{})
+}
+
+func jsonDecoder[T any](opts ...JSONOption) func([]byte) (T, error) {
+	options := newJSONOptions(opts)
+
+	return func(data []byte) (T, error) {
+		return jsonDecodeWithOptions[T](data, options)
+	}
+}
+
+func jsonUnmarshaler(opts ...JSONOption) func([]byte, any) error {
+	options := newJSONOptions(opts)
 
+	return func(data []byte, v any) error {
+		return jsonUnmarshalWithOptions(data, v, options)
+	}
+}
+
+func newJSONOptions(opts []JSONOption) jsonOptions {
+	options := jsonOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func jsonDecodeWithOptions[T any](data []byte, options jsonOptions) (T, error) {
 	t := *new(T)
-	if err := jsonifier.Decode(&t); err != nil {
+	if err := jsonUnmarshalWithOptions(data, &t, options); err != nil {
 		logger.Debug("Failed to JSON decode", "Error", err)
-		return t, err
+		return *new(T), err
 	}
 
-	logger.Debug("JSON decoded", "Type", reflect.TypeOf(t), "Instance", t)
+	logger.Debug("JSON decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
 	return t, nil
 }
+
+func jsonUnmarshalWithOptions(data []byte, v any, options jsonOptions) error {
+	if options.maxDepth > 0 {
+		if err := checkJSONDepth(data, options.maxDepth); err != nil {
+			return err
+		}
+	}
+
+	jsonifier := json.NewDecoder(bytes.NewReader(data))
+	if options.disallowUnknownFields {
+		jsonifier.DisallowUnknownFields()
+	}
+	if options.useNumber {
+		jsonifier.UseNumber()
+	}
+
+	if err := jsonifier.Decode(v); err != nil {
+		return err
+	}
+
+	if options.rejectTrailingData {
+		if _, err := jsonifier.Token(); err != io.EOF {
+			return ErrJSONTrailingData
+		}
+	}
+
+	return nil
+}
+
+// Scans data for object and array nesting deeper than maxDepth, without decoding it.
+func checkJSONDepth(data []byte, maxDepth int) error {
+	depth := 0
+	inString := false
+	escaped := false
+
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > maxDepth {
+				return ErrJSONTooDeep
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return nil
+}
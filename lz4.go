@@ -0,0 +1,281 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+var ErrLZ4Corrupt = fmt.Errorf("lz4 block is corrupt")
+
+const (
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5
+	lz4MFLimit      = 12
+	lz4HashLog      = 16
+	lz4MinHashLog   = 8
+	lz4MaxOffset    = 65535
+	// Each byte of a block can expand to at most 255 bytes, which bounds the size a reader will trust
+	lz4MaxRatio = 255
+)
+
+type lz4Compressor struct{}
+
+// Creates a compressor producing LZ4 blocks, written in pure Go. It compresses less than zlib but is many times faster, which suits high rate links where CPU matters more than bandwidth.
+//
+// Each message is a single LZ4 block preceded by its uncompressed size as a uvarint, so the bytes after the size can be decoded by any LZ4 block decoder. LZ4 has no compression levels.
+func LZ4Compressor() Compressor {
+	return lz4Compressor{}
+}
+
+func (c lz4Compressor) ID() byte {
+	return 6
+}
+
+func (c lz4Compressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return &lz4Writer{w: w}, nil
+}
+
+func (c lz4Compressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		logger.Error("Failed to decompress data. The uncompressed size is missing", "Error", ErrLZ4Corrupt)
+		return nil, fmt.Errorf("%w: uncompressed size is missing", ErrLZ4Corrupt)
+	}
+
+	block := data[n:]
+	if size > uint64(len(block))*lz4MaxRatio {
+		logger.Error("Failed to decompress data. The uncompressed size is larger than the block could hold", "Size", size, "BlockByteCount", len(block))
+		return nil, fmt.Errorf("%w: uncompressed size %d is too large for a %d byte block", ErrLZ4Corrupt, size, len(block))
+	}
+
+	return &lz4Reader{block: block, size: size}, nil
+}
+
+// Decompresses the block on the first read, so a decompression limit can be checked against the size first.
+type lz4Reader struct {
+	block  []byte
+	size   uint64
+	reader *bytes.Reader
+}
+
+func (l *lz4Reader) uncompressedSize() uint64 {
+	return l.size
+}
+
+func (l *lz4Reader) Read(p []byte) (int, error) {
+	if l.reader == nil {
+		decompressed, err := lz4DecompressBlock(l.block, int(l.size))
+		if err != nil {
+			logger.Error("Failed to decompress LZ4 block", "Error", err)
+			return 0, err
+		}
+		l.reader = bytes.NewReader(decompressed)
+	}
+
+	return l.reader.Read(p)
+}
+
+func (l *lz4Reader) Close() error {
+	return nil
+}
+
+// Buffers the whole payload, since an LZ4 block is compressed in one go.
+type lz4Writer struct {
+	w      io.Writer
+	buffer bytes.Buffer
+}
+
+func (l *lz4Writer) Write(p []byte) (int, error) {
+	return l.buffer.Write(p)
+}
+
+func (l *lz4Writer) Close() error {
+	data := l.buffer.Bytes()
+
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	out = lz4CompressBlock(out, data)
+
+	_, err := writeFull(l.w, out)
+	return err
+}
+
+func lz4Hash(v uint32, hashLog int) uint32 {
+	return (v * 2654435761) >> (32 - hashLog)
+}
+
+// Appends src compressed as an LZ4 block to dst, using a single pass with a hash table of the last position each 4 byte sequence was seen at.
+func lz4CompressBlock(dst, src []byte) []byte {
+	if len(src) < lz4MFLimit+1 {
+		return lz4AppendSequence(dst, src, 0, 0)
+	}
+
+	// Small messages only have a few positions to remember, so size the table to the input rather than allocating the full table for each one
+	hashLog := min(max(bits.Len(uint(len(src))), lz4MinHashLog), lz4HashLog)
+
+	// Positions are stored plus one so zero means empty
+	table := make([]int32, 1<<hashLog)
+
+	anchor := 0
+	matchLimit := len(src) - lz4LastLiterals
+	for i := 0; i <= len(src)-lz4MFLimit; {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := lz4Hash(v, hashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != v {
+			// Step faster through data that isn't matching, as it is unlikely to start matching
+			i += 1 + (i-anchor)>>6
+			continue
+		}
+
+		for i > anchor && ref > 0 && src[i-1] == src[ref-1] {
+			i--
+			ref--
+		}
+
+		end := i + lz4MinMatch
+		for end < matchLimit && src[end] == src[ref+end-i] {
+			end++
+		}
+
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, end-i)
+		i = end
+		anchor = end
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// Appends a sequence of literals followed by a match. A matchLen of zero appends only the literals, as the last sequence of a block must.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	litLen := len(literals)
+	token := byte(min(litLen, 15)) << 4
+
+	extraMatchLen := matchLen - lz4MinMatch
+	if matchLen > 0 {
+		token |= byte(min(extraMatchLen, 15))
+	}
+
+	dst = append(dst, token)
+	if litLen >= 15 {
+		dst = lz4AppendLength(dst, litLen-15)
+	}
+	dst = append(dst, literals...)
+
+	if matchLen == 0 {
+		return dst
+	}
+
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if extraMatchLen >= 15 {
+		dst = lz4AppendLength(dst, extraMatchLen-15)
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for n >= 255 {
+		dst = append(dst, 255)
+		n -= 255
+	}
+	return append(dst, byte(n))
+}
+
+// Reads an extended length, returning the number of bytes it took. Lengths that would exceed limit are reported as corrupt.
+func lz4ReadLength(src []byte, limit int) (int, int, error) {
+	n := 0
+	for i, b := range src {
+		n += int(b)
+		if n > limit {
+			return 0, 0, fmt.Errorf("%w: length exceeds the uncompressed size", ErrLZ4Corrupt)
+		}
+		if b != 255 {
+			return n, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: length is truncated", ErrLZ4Corrupt)
+}
+
+// Decompresses an LZ4 block that must decompress to exactly size bytes.
+func lz4DecompressBlock(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+
+	i := 0
+	for {
+		if i >= len(src) {
+			return nil, fmt.Errorf("%w: block is truncated", ErrLZ4Corrupt)
+		}
+
+		token := src[i]
+		i++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			n, read, err := lz4ReadLength(src[i:], size)
+			if err != nil {
+				return nil, err
+			}
+			litLen += n
+			i += read
+		}
+
+		if litLen > len(src)-i || litLen > size-len(dst) {
+			return nil, fmt.Errorf("%w: literals overrun the block", ErrLZ4Corrupt)
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+
+		if i == len(src) {
+			break
+		}
+
+		if len(src)-i < 2 {
+			return nil, fmt.Errorf("%w: match offset is truncated", ErrLZ4Corrupt)
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("%w: match offset %d is out of range", ErrLZ4Corrupt, offset)
+		}
+
+		matchLen := int(token&15) + lz4MinMatch
+		if token&15 == 15 {
+			n, read, err := lz4ReadLength(src[i:], size)
+			if err != nil {
+				return nil, err
+			}
+			matchLen += n
+			i += read
+		}
+
+		if matchLen > size-len(dst) {
+			return nil, fmt.Errorf("%w: match overruns the uncompressed size", ErrLZ4Corrupt)
+		}
+
+		start := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[start:start+matchLen]...)
+		} else {
+			// The match overlaps the bytes it is producing, so it has to be copied a byte at a time
+			for k := range matchLen {
+				dst = append(dst, dst[start+k])
+			}
+		}
+	}
+
+	if len(dst) != size {
+		return nil, fmt.Errorf("%w: decompressed to %d bytes, expected %d", ErrLZ4Corrupt, len(dst), size)
+	}
+
+	return dst, nil
+}
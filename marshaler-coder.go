@@ -0,0 +1,88 @@
+package onthewire
+
+import (
+	"encoding"
+	"reflect"
+)
+
+var (
+	binaryMarshalerType   = reflect.TypeFor[encoding.BinaryMarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+	textMarshalerType     = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType   = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Builds an encoder and decoder for T that let the type control its own wire form. If T implements both `encoding.BinaryMarshaler` and `encoding.BinaryUnmarshaler` (on T or *T) those are used, otherwise the `encoding.TextMarshaler` pair. Types implementing neither pair fall back to Gob Encoding.
+func marshalerCoder[T any]() (func(T) ([]byte, error), func([]byte) (T, error)) {
+	typ := reflect.TypeFor[T]()
+
+	switch {
+	case implementsPair(typ, binaryMarshalerType, binaryUnmarshalerType):
+		logger.Debug("Using binary marshaler encoding", "Type", typ)
+		return marshalerEncode[T](binaryMarshalerType, func(m any) ([]byte, error) {
+				return m.(encoding.BinaryMarshaler).MarshalBinary()
+			}), marshalerDecode[T](func(u any, data []byte) error {
+				return u.(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+			})
+	case implementsPair(typ, textMarshalerType, textUnmarshalerType):
+		logger.Debug("Using text marshaler encoding", "Type", typ)
+		return marshalerEncode[T](textMarshalerType, func(m any) ([]byte, error) {
+				return m.(encoding.TextMarshaler).MarshalText()
+			}), marshalerDecode[T](func(u any, data []byte) error {
+				return u.(encoding.TextUnmarshaler).UnmarshalText(data)
+			})
+	default:
+		logger.Warn("Type implements no marshaler pair, falling back to Gob Encoding", "Type", typ)
+		return gobEncode[T], gobDecode[T]
+	}
+}
+
+func implementsPair(typ reflect.Type, marshaler reflect.Type, unmarshaler reflect.Type) bool {
+	canMarshal := typ.Implements(marshaler) || reflect.PointerTo(typ).Implements(marshaler)
+	canUnmarshal := reflect.PointerTo(typ).Implements(unmarshaler) || (typ.Kind() == reflect.Pointer && typ.Implements(unmarshaler))
+	return canMarshal && canUnmarshal
+}
+
+func marshalerEncode[T any](marshalerType reflect.Type, marshal func(any) ([]byte, error)) func(T) ([]byte, error) {
+	// Marshalers with pointer receivers are called on the address of a copy
+	byPointer := !reflect.TypeFor[T]().Implements(marshalerType)
+
+	return func(t T) ([]byte, error) {
+		var m any = t
+		if byPointer {
+			m = &t
+		}
+
+		encoded, err := marshal(m)
+		if err != nil {
+			logger.Error("Failed to marshal", "Error", err)
+			return nil, err
+		}
+
+		logger.Debug("Marshaled", "Type", reflect.TypeOf(t), "ByteCount", len(encoded), "Bytes", logBytes(encoded, reflect.TypeOf(t)))
+		return encoded, nil
+	}
+}
+
+func marshalerDecode[T any](unmarshal func(any, []byte) error) func([]byte) (T, error) {
+	typ := reflect.TypeFor[T]()
+
+	return func(data []byte) (T, error) {
+		t := *new(T)
+
+		// Pointer types are allocated and unmarshaled into directly, anything else through its address
+		var target any = &t
+		if typ.Kind() == reflect.Pointer {
+			t = reflect.New(typ.Elem()).Interface().(T)
+			target = t
+		}
+
+		if err := unmarshal(target, data); err != nil {
+			logger.Error("Failed to unmarshal", "Error", err)
+			return *new(T), err
+		}
+
+		logger.Debug("Unmarshaled", "Type", typ, "Instance", logInstance(t))
+		return t, nil
+	}
+}
@@ -0,0 +1,910 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// Limits how deeply arrays and maps can be nested when decoding, so that a message of nested headers cannot exhaust the stack. The same as encoding/json.
+const maxDecodeDepth = 10000
+
+func msgpackEncode[T any](t T) ([]byte, error) {
+	encoded, err := msgpackMarshal(t)
+	if err != nil {
+		logger.Error("Failed to MessagePack encode", "Error", err)
+		return nil, err
+	}
+
+	logger.Debug("MessagePack encoded", "Type", reflect.TypeOf(t), "ByteCount", len(encoded), "Bytes", logBytes(encoded, reflect.TypeOf(t)))
+	return encoded, nil
+}
+
+func msgpackDecode[T any](data []byte) (T, error) {
+	t := *new(T)
+	if err := msgpackUnmarshal(data, &t); err != nil {
+		logger.Error("Failed to MessagePack decode", "Error", err)
+		return t, err
+	}
+
+	logger.Debug("MessagePack decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
+	return t, nil
+}
+
+func msgpackMarshal(v any) ([]byte, error) {
+	return msgpackAppendValue(nil, reflect.ValueOf(v))
+}
+
+func msgpackUnmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("msgpack: decode target must be a non-nil pointer, got %T", v)
+	}
+
+	d := &msgpackDecoder{data: data}
+	if err := d.decodeValue(rv.Elem()); err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return fmt.Errorf("msgpack: %d unexpected trailing bytes", len(d.data)-d.pos)
+	}
+
+	return nil
+}
+
+func msgpackAppendValue(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, 0xc0), nil
+	}
+
+	if v.Type() == timeType {
+		return msgpackAppendTime(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return msgpackAppendInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return msgpackAppendUint(b, v.Uint()), nil
+	case reflect.Float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return msgpackAppendString(b, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return msgpackAppendBinary(b, v.Bytes()), nil
+		}
+		return msgpackAppendArray(b, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return msgpackAppendBinary(b, data), nil
+		}
+		return msgpackAppendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return msgpackAppendMap(b, v)
+	case reflect.Struct:
+		return msgpackAppendStruct(b, v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return msgpackAppendValue(b, v.Elem())
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+}
+
+func msgpackAppendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return msgpackAppendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func msgpackAppendUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func msgpackAppendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackAppendBinary(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, data...)
+}
+
+func msgpackAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func msgpackAppendArray(b []byte, v reflect.Value) ([]byte, error) {
+	b = msgpackAppendArrayHeader(b, v.Len())
+
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if b, err = msgpackAppendValue(b, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Map entries are sorted by their encoded key so the same map always produces the same bytes.
+func msgpackAppendMap(b []byte, v reflect.Value) ([]byte, error) {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := msgpackAppendValue(nil, iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	b = msgpackAppendMapHeader(b, len(entries))
+
+	var err error
+	for _, e := range entries {
+		b = append(b, e.key...)
+		if b, err = msgpackAppendValue(b, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func msgpackAppendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	fields := structFields(v.Type(), "msgpack")
+
+	values := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		// Fields promoted through a nil embedded pointer are left out
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		values = append(values, fv)
+		names = append(names, f.name)
+	}
+
+	b = msgpackAppendMapHeader(b, len(values))
+
+	var err error
+	for i, fv := range values {
+		b = msgpackAppendString(b, names[i])
+		if b, err = msgpackAppendValue(b, fv); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Times use the MessagePack timestamp extension (type -1) in its smallest form.
+func msgpackAppendTime(b []byte, t time.Time) []byte {
+	sec := t.Unix()
+	nsec := uint64(t.Nanosecond())
+
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd6, 0xff), uint32(sec))
+	case sec >= 0 && sec>>34 == 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xd7, 0xff), nsec<<34|uint64(sec))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc7, 12, 0xff), uint32(nsec))
+		return binary.BigEndian.AppendUint64(b, uint64(sec))
+	}
+}
+
+type msgpackDecoder struct {
+	data          []byte
+	pos           int
+	depth         int
+	lastWasUint64 bool
+}
+
+// Tracks the nesting depth of the value being decoded, which must be undone with leave once it is.
+func (d *msgpackDecoder) enter() error {
+	d.depth++
+	if d.depth > maxDecodeDepth {
+		return fmt.Errorf("msgpack: exceeded max nesting depth of %d", maxDecodeDepth)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	c := d.data[d.pos]
+	d.pos++
+	return c, nil
+}
+
+func (d *msgpackDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// Reads a length for a container of n elements, rejecting lengths that could not possibly fit in the remaining data.
+func (d *msgpackDecoder) readLength(size int, minElementSize int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if n*uint64(minElementSize) > uint64(len(d.data)-d.pos) {
+		return 0, fmt.Errorf("msgpack: length %d exceeds remaining data", n)
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *msgpackDecoder) decodeValue(v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	if c == 0xc0 {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Type() == timeType {
+		t, err := d.decodeTime()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: cannot decode into non-empty interface %s", v.Type())
+		}
+		value, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.Bool:
+		d.pos++
+		switch c {
+		case 0xc2:
+			v.SetBool(false)
+		case 0xc3:
+			v.SetBool(true)
+		default:
+			return fmt.Errorf("msgpack: cannot decode 0x%02x into %s", c, v.Type())
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := d.decodeInt()
+		if err != nil {
+			return err
+		}
+		if d.lastWasUint64 {
+			return fmt.Errorf("msgpack: %d overflows %s", uint64(i), v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := d.decodeInt()
+		if err != nil {
+			return err
+		}
+		if i < 0 && !d.lastWasUint64 {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		u := uint64(i)
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := d.decodeFloat()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		s, err := d.decodeBytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(s))
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && isMsgpackBytes(c) {
+			s, err := d.decodeBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, s...))
+			return nil
+		}
+		n, err := d.decodeArrayHeader()
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decodeValue(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && isMsgpackBytes(c) {
+			s, err := d.decodeBytes()
+			if err != nil {
+				return err
+			}
+			if len(s) != v.Len() {
+				return fmt.Errorf("msgpack: cannot decode %d bytes into %s", len(s), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(s))
+			return nil
+		}
+		n, err := d.decodeArrayHeader()
+		if err != nil {
+			return err
+		}
+		if n != v.Len() {
+			return fmt.Errorf("msgpack: cannot decode array of %d elements into %s", n, v.Type())
+		}
+		for i := 0; i < n; i++ {
+			if err := d.decodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		n, err := d.decodeMapHeader()
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decodeValue(key); err != nil {
+				return err
+			}
+			// Interface keys can hold decoded slices and maps, which can't be used as keys
+			if !key.Comparable() {
+				return fmt.Errorf("msgpack: unsupported map key of type %s", key.Elem().Type())
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decodeValue(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		return d.decodeStruct(v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+}
+
+func (d *msgpackDecoder) decodeStruct(v reflect.Value) error {
+	n, err := d.decodeMapHeader()
+	if err != nil {
+		return err
+	}
+
+	fields := structFields(v.Type(), "msgpack")
+	byName := make(map[string]structField, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := d.decodeBytes()
+		if err != nil {
+			return err
+		}
+
+		f, ok := byName[string(name)]
+		if !ok {
+			if _, err := d.decodeAny(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.decodeValue(fieldByIndexAlloc(v, f.index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the field at index, allocating any nil embedded pointers on the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func isMsgpackBytes(c byte) bool {
+	return c&0xe0 == 0xa0 || (c >= 0xc4 && c <= 0xc6) || (c >= 0xd9 && c <= 0xdb)
+}
+
+func (d *msgpackDecoder) decodeBytes() ([]byte, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xc4 || c == 0xd9:
+		n, err = d.readLength(1, 1)
+	case c == 0xc5 || c == 0xda:
+		n, err = d.readLength(2, 1)
+	case c == 0xc6 || c == 0xdb:
+		n, err = d.readLength(4, 1)
+	default:
+		return nil, fmt.Errorf("msgpack: expected string or binary, got 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.readN(n)
+}
+
+func (d *msgpackDecoder) decodeArrayHeader() (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f), nil
+	case c == 0xdc:
+		return d.readLength(2, 1)
+	case c == 0xdd:
+		return d.readLength(4, 1)
+	default:
+		return 0, fmt.Errorf("msgpack: expected array, got 0x%02x", c)
+	}
+}
+
+func (d *msgpackDecoder) decodeMapHeader() (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		return d.readLength(2, 2)
+	case c == 0xdf:
+		return d.readLength(4, 2)
+	default:
+		return 0, fmt.Errorf("msgpack: expected map, got 0x%02x", c)
+	}
+}
+
+// Decodes any integer format as an int64. Values above math.MaxInt64 are returned wrapped and flagged with lastWasUint64.
+func (d *msgpackDecoder) decodeInt() (int64, error) {
+	d.lastWasUint64 = false
+
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	}
+
+	switch c {
+	case 0xcc, 0xcd, 0xce:
+		u, err := d.readUint(1 << (c - 0xcc))
+		return int64(u), err
+	case 0xcf:
+		u, err := d.readUint(8)
+		d.lastWasUint64 = u > math.MaxInt64
+		return int64(u), err
+	case 0xd0:
+		u, err := d.readUint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.readUint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.readUint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.readUint(8)
+		return int64(u), err
+	default:
+		return 0, fmt.Errorf("msgpack: expected integer, got 0x%02x", c)
+	}
+}
+
+func (d *msgpackDecoder) decodeFloat() (float64, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+
+	switch c {
+	case 0xca:
+		d.pos++
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		d.pos++
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	default:
+		i, err := d.decodeInt()
+		if d.lastWasUint64 {
+			return float64(uint64(i)), err
+		}
+		return float64(i), err
+	}
+}
+
+func (d *msgpackDecoder) decodeTime() (time.Time, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var size int
+	switch c {
+	case 0xd6:
+		size = 4
+	case 0xd7:
+		size = 8
+	case 0xc7:
+		n, err := d.readUint(1)
+		if err != nil {
+			return time.Time{}, err
+		}
+		size = int(n)
+	default:
+		return time.Time{}, fmt.Errorf("msgpack: expected timestamp, got 0x%02x", c)
+	}
+
+	extType, err := d.readByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if int8(extType) != -1 {
+		return time.Time{}, fmt.Errorf("msgpack: expected timestamp extension, got type %d", int8(extType))
+	}
+
+	body, err := d.readN(size)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch size {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(body)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(body)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(body[:4])
+		sec := int64(binary.BigEndian.Uint64(body[4:]))
+		return time.Unix(sec, int64(nsec)), nil
+	default:
+		return time.Time{}, fmt.Errorf("msgpack: invalid timestamp length %d", size)
+	}
+}
+
+// Decodes the next value into its natural Go representation, as used for `any` targets. Integers become int64, or uint64 when they do not fit.
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c == 0xc0:
+		d.pos++
+		return nil, nil
+	case c == 0xc2 || c == 0xc3:
+		d.pos++
+		return c == 0xc3, nil
+	case c <= 0x7f || c >= 0xe0 || (c >= 0xcc && c <= 0xd3):
+		i, err := d.decodeInt()
+		if d.lastWasUint64 {
+			return uint64(i), err
+		}
+		return i, err
+	case c == 0xca || c == 0xcb:
+		return d.decodeFloat()
+	case c&0xe0 == 0xa0 || (c >= 0xd9 && c <= 0xdb):
+		s, err := d.decodeBytes()
+		return string(s), err
+	case c >= 0xc4 && c <= 0xc6:
+		s, err := d.decodeBytes()
+		return append([]byte{}, s...), err
+	case c&0xf0 == 0x90 || c == 0xdc || c == 0xdd:
+		n, err := d.decodeArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case c&0xf0 == 0x80 || c == 0xde || c == 0xdf:
+		return d.decodeAnyMap()
+	case c >= 0xd4 && c <= 0xd8 || c >= 0xc7 && c <= 0xc9:
+		if d.isTimestamp() {
+			return d.decodeTime()
+		}
+		return d.skipExtension()
+	default:
+		return nil, fmt.Errorf("msgpack: unknown format 0x%02x", c)
+	}
+}
+
+func (d *msgpackDecoder) decodeAnyMap() (any, error) {
+	n, err := d.decodeMapHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]any, n)
+	values := make([]any, n)
+	stringKeys := true
+	for i := 0; i < n; i++ {
+		if keys[i], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+		if values[i], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+		if _, ok := keys[i].(string); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]any, n)
+		for i := range keys {
+			m[keys[i].(string)] = values[i]
+		}
+		return m, nil
+	}
+
+	m := make(map[any]any, n)
+	for i := range keys {
+		if keys[i] != nil && !reflect.TypeOf(keys[i]).Comparable() {
+			return nil, fmt.Errorf("msgpack: unsupported map key of type %T", keys[i])
+		}
+		m[keys[i]] = values[i]
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) isTimestamp() bool {
+	typePos := d.pos + 1
+	if d.data[d.pos] == 0xc7 {
+		typePos++
+	}
+	switch d.data[d.pos] {
+	case 0xd6, 0xd7, 0xc7:
+		return typePos < len(d.data) && int8(d.data[typePos]) == -1
+	default:
+		return false
+	}
+}
+
+// Unknown extension types are returned as their raw bytes.
+func (d *msgpackDecoder) skipExtension() (any, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	switch c {
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		size = 1 << (c - 0xd4)
+	case 0xc7:
+		size, err = d.readLength(1, 1)
+	case 0xc8:
+		size, err = d.readLength(2, 1)
+	case 0xc9:
+		size, err = d.readLength(4, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.readByte(); err != nil {
+		return nil, err
+	}
+
+	body, err := d.readN(size)
+	return append([]byte{}, body...), err
+}
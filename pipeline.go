@@ -1,8 +1,9 @@
 package onthewire
 
 import (
-	"bytes"
+	"compress/zlib"
 	"crypto/rsa"
+	"encoding/binary"
 	"io"
 	"reflect"
 	"slices"
@@ -17,18 +18,32 @@ type Pipeline[T any] struct {
 
 // Represents a pipeline of write operations for any type W. The underlying operations act upon byte slices and return byte slices and error if one occured.
 type WritePipeline[W any] struct {
-	encoder         func(W) ([]byte, error)
-	writeOperations []func([]byte) ([]byte, error)
-	useTimeout      bool
-	timeoutDuration time.Duration
+	encoder          func(W) ([]byte, error)
+	encoderErr       error
+	codec            byte
+	newStreamEncoder func() func(W) ([]byte, error)
+	writeOperations  []pipelineOperation
+	useSchema        bool
+	schemaVersion    int
+	typeRegistry     *TypeRegistry
+	fieldCipher      fieldCipher
+	useArmor         bool
+	armorFormat      ArmorFormat
+	chunkSize        int
+	varintLengths    bool
+	useFrameHeader   bool
+	operationErr     error
+	useTimeout       bool
+	timeoutDuration  time.Duration
+	streams          streamReleasers
 }
 
 // Creates a new empty pipeline supporting write operations.
 //
-// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Gob encoder will be used at build time.
+// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Raw encoder will be used at build time when the type is a []byte, string or io.Reader, otherwise the Gob encoder will be used.
 func NewWritePipeline[W any]() *WritePipeline[W] {
 	return &WritePipeline[W]{
-		writeOperations: make([]func([]byte) ([]byte, error), 0),
+		writeOperations: make([]pipelineOperation, 0),
 		encoder:         nil,
 		useTimeout:      false,
 		timeoutDuration: time.Second,
@@ -37,18 +52,34 @@ func NewWritePipeline[W any]() *WritePipeline[W] {
 
 // Represents a pipeline of read operations for any type R. The underlying operations act upon byte slices and return byte slices and error if one occured.
 type ReadPipeline[R any] struct {
-	readOperations  []func([]byte) ([]byte, error)
-	decoder         func([]byte) (R, error)
-	useTimeout      bool
-	timeoutDuration time.Duration
+	readOperations   []pipelineOperation
+	decoder          func([]byte) (R, error)
+	decoderErr       error
+	codec            byte
+	newStreamDecoder func() func([]byte) (R, error)
+	unmarshal        func([]byte, any) error
+	schema           *Schema
+	typeRegistry     *TypeRegistry
+	fieldCipher      fieldCipher
+	validators       []func(R) error
+	validatorErr     error
+	useArmor         bool
+	armorFormat      ArmorFormat
+	maxMessageSize   int
+	varintLengths    bool
+	useFrameHeader   bool
+	operationErr     error
+	useTimeout       bool
+	timeoutDuration  time.Duration
+	streams          streamReleasers
 }
 
 // Creates a new empty pipeline supporting read operations.
 //
-// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Gob encoder will be used at build time.
+// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Raw encoder will be used at build time when the type is a []byte, string or io.Reader, otherwise the Gob encoder will be used.
 func NewReadPipeline[R any]() *ReadPipeline[R] {
 	return &ReadPipeline[R]{
-		readOperations:  make([]func([]byte) ([]byte, error), 0),
+		readOperations:  make([]pipelineOperation, 0),
 		decoder:         nil,
 		useTimeout:      false,
 		timeoutDuration: time.Second,
@@ -57,7 +88,7 @@ func NewReadPipeline[R any]() *ReadPipeline[R] {
 
 // Creates a new empty pipeline with read and write pipelines underpinning it's operation.
 //
-// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Gob encoder will be used at build time.
+// This pipeline can be build and used immediately. By default, if no encoder has been selected, the Raw encoder will be used at build time when the type is a []byte, string or io.Reader, otherwise the Gob encoder will be used.
 func New[T any]() *Pipeline[T] {
 	return &Pipeline[T]{
 		readPipeline:  NewReadPipeline[T](),
@@ -66,10 +97,20 @@ func New[T any]() *Pipeline[T] {
 }
 
 // Compiles the pipline into a read func and write func following the specification of the pipeline operations and selected encoders.
+//
+// Build panics if the selected encoding cannot handle T, such as when fixed-layout binary encoding is used with a variable size type or raw encoding with a type that isn't a []byte, string or io.Reader.
 func (p *Pipeline[T]) Build() (func(io.Reader) (T, error), func(T, io.Writer) error) {
 	return p.readPipeline.Build(), p.writePipeline.Build()
 }
 
+// Discards the state kept for stream by the read and write funcs built from this pipeline, such as Gob stream encoders and decoders or stream compression contexts.
+//
+// Call it once a stream is finished with, such as when a connection is closed. Otherwise the state, and the stream itself, is kept until a read or write on the stream fails.
+func (p *Pipeline[T]) Release(stream any) {
+	p.readPipeline.streams.release(stream)
+	p.writePipeline.streams.release(stream)
+}
+
 // Custom Operations allow the consumer to define their own write and read operations to append to the pipeline.
 //
 // Both functions take in a []byte and output a modified []byte or error. It is ok to return a new []byte or modify the existing one.
@@ -81,10 +122,57 @@ func (p *Pipeline[T]) UseCustomOperation(readFn, writeFn func([]byte) ([]byte, e
 
 // Appends a compression step to the write operations and a decompression strep to the read operations.//
 //
-// Compression is done with the `compress/zlib` library.
-func (p *Pipeline[T]) UseCompression() *Pipeline[T] {
+// Compression is done with the `compress/zlib` library. Options such as MaxDecompressedSize protect the reader from payloads that decompress to an excessive size.
+func (p *Pipeline[T]) UseCompression(opts ...DecompressionOption) *Pipeline[T] {
 	p.writePipeline.UseCompression()
-	p.readPipeline.UseCompression()
+	p.readPipeline.UseCompression(opts...)
+	return p
+}
+
+// Appends a compression step using c to the write operations and a decompression step to the read operations.
+//
+// The ID of the compressor is written ahead of the compressed data, so reading data compressed with a different compressor fails with ErrCompressionMismatch. Build panics if c cannot be used, such as when it was given an invalid level.
+func (p *Pipeline[T]) UseCompressionWith(c Compressor, opts ...DecompressionOption) *Pipeline[T] {
+	p.writePipeline.UseCompressionWith(c)
+	p.readPipeline.UseCompressionWith(c, opts...)
+	return p
+}
+
+// Appends a zlib compression step to the write operations that stores payloads uncompressed when they are smaller than minSize or compression doesn't make them smaller, and the matching decompression step to the read operations.
+//
+// This is the same as UseCompressionWith(AdaptiveCompressor(ZlibCompressor(zlib.DefaultCompression), minSize)).
+func (p *Pipeline[T]) UseAdaptiveCompression(minSize int) *Pipeline[T] {
+	p.writePipeline.UseAdaptiveCompression(minSize)
+	p.readPipeline.UseAdaptiveCompression(minSize)
+	return p
+}
+
+// Appends a zlib compression step using a preset dictionary to the write operations and the matching decompression step to the read operations. Messages are compressed with the first dictionary and can be read with any of them.
+//
+// This is the same as UseCompressionWith(DictionaryCompressor(zlib.DefaultCompression, dicts...)). Build panics if no dictionaries are given.
+func (p *Pipeline[T]) UseDictionaryCompression(dicts ...[]byte) *Pipeline[T] {
+	p.writePipeline.UseDictionaryCompression(dicts...)
+	p.readPipeline.UseDictionaryCompression(dicts...)
+	return p
+}
+
+// Appends an LZ4 compression step to the write operations and the matching decompression step to the read operations. LZ4 compresses less than zlib but is much faster.
+//
+// This is the same as UseCompressionWith(LZ4Compressor()).
+func (p *Pipeline[T]) UseLZ4Compression() *Pipeline[T] {
+	p.writePipeline.UseLZ4Compression()
+	p.readPipeline.UseLZ4Compression()
+	return p
+}
+
+// Appends a compression step to the write operations and a decompression step to the read operations that keep one flate context for the lifetime of each stream.
+//
+// Each message is flushed rather than compressed separately, so later messages can refer back to earlier ones on the same stream (the io.Writer or io.Reader passed to the built functions). This gives much better ratios for chatty protocols of small, similar messages. The state for a stream is discarded if a read or write on it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept. Both ends must use stream compression and see every message in order.
+//
+// Levels below 7, including flate.DefaultCompression, don't refer back to earlier messages from messages shorter than 128 bytes, so flate.BestCompression suits protocols of very small messages best. Build panics if level is invalid.
+func (p *Pipeline[T]) UseStreamCompression(level int, opts ...DecompressionOption) *Pipeline[T] {
+	p.writePipeline.UseStreamCompression(level)
+	p.readPipeline.UseStreamCompression(opts...)
 	return p
 }
 
@@ -97,13 +185,85 @@ func (p *Pipeline[T]) UseGobEncoding() *Pipeline[T] {
 	return p
 }
 
+// Enables on-boarding and off-boarding to the pipeline using Go Object Encoding, with the encoder and decoder kept for the lifetime of each stream.
+//
+// Type descriptors are only sent with the first message on a stream (the io.Writer or io.Reader passed to the built functions), making later messages much smaller. The state for a stream is discarded if a read or write on it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept. Both ends must use this encoding.
+func (p *Pipeline[T]) UseGobStreamEncoding() *Pipeline[T] {
+	p.readPipeline.UseGobStreamEncoding()
+	p.writePipeline.UseGobStreamEncoding()
+	return p
+}
+
 // Enables on-boarding and off-boarding to the pipeline using JSON Encoding.
-func (p *Pipeline[T]) UseJSONEncoding() *Pipeline[T] {
-	p.readPipeline.UseJSONEncoding()
+//
+// Options such as JSONDisallowUnknownFields make decoding stricter, so schema drift between services results in an error rather than silently lost data.
+func (p *Pipeline[T]) UseJSONEncoding(opts ...JSONOption) *Pipeline[T] {
+	p.readPipeline.UseJSONEncoding(opts...)
 	p.writePipeline.UseJSONEncoding()
 	return p
 }
 
+// Enables on-boarding and off-boarding to the pipeline without any serialisation, passing the bytes of T straight into the operations.
+//
+// T must be a []byte, string or io.Reader, otherwise Build will panic. This is selected automatically when no encoding has been chosen and T is one of those types.
+func (p *Pipeline[T]) UseRawEncoding() *Pipeline[T] {
+	p.readPipeline.UseRawEncoding()
+	p.writePipeline.UseRawEncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using the marshaling methods of T itself, so types control their own wire form.
+//
+// If T implements `encoding.BinaryMarshaler` and `encoding.BinaryUnmarshaler` those are used, otherwise `encoding.TextMarshaler` and `encoding.TextUnmarshaler`. Types implementing neither pair fall back to Gob Encoding.
+func (p *Pipeline[T]) UseMarshalerEncoding() *Pipeline[T] {
+	p.readPipeline.UseMarshalerEncoding()
+	p.writePipeline.UseMarshalerEncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using canonical JSON Encoding, in the style of RFC 8785.
+//
+// Object keys are sorted, numbers are normalised and there is no insignificant whitespace, so a peer in another language that re-serialises the JSON produces the same bytes. Integers beyond 2^53 - 1 cannot be represented and fail to encode.
+func (p *Pipeline[T]) UseCanonicalJSONEncoding() *Pipeline[T] {
+	p.readPipeline.UseCanonicalJSONEncoding()
+	p.writePipeline.UseCanonicalJSONEncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using XML Encoding, backed by `encoding/xml`.
+func (p *Pipeline[T]) UseXMLEncoding() *Pipeline[T] {
+	p.readPipeline.UseXMLEncoding()
+	p.writePipeline.UseXMLEncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using MessagePack Encoding.
+//
+// Structs are encoded as maps keyed by field name, which can be overridden with `msgpack:"name,omitempty"` struct tags.
+func (p *Pipeline[T]) UseMsgPackEncoding() *Pipeline[T] {
+	p.readPipeline.UseMsgPackEncoding()
+	p.writePipeline.UseMsgPackEncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using deterministic CBOR (RFC 8949) Encoding.
+//
+// Encoding follows the core deterministic encoding requirements, so equal values always produce identical bytes. Structs are encoded as maps keyed by field name, which can be overridden with `cbor:"name,omitempty"` struct tags.
+func (p *Pipeline[T]) UseCBOREncoding() *Pipeline[T] {
+	p.readPipeline.UseCBOREncoding()
+	p.writePipeline.UseCBOREncoding()
+	return p
+}
+
+// Enables on-boarding and off-boarding to the pipeline using a fixed binary layout with the given byte order, built on `encoding/binary`.
+//
+// T must be plain data: booleans, sized numbers, arrays and structs of those. Integer fields tagged with `otw:"varint"` are written as varints, which also allows `int` and `uint`. Build will panic if T has fields of variable size.
+func (p *Pipeline[T]) UseBinaryEncoding(order binary.ByteOrder) *Pipeline[T] {
+	p.readPipeline.UseBinaryEncoding(order)
+	p.writePipeline.UseBinaryEncoding(order)
+	return p
+}
+
 // Use RSA asymmetric encryption for encrypting and decrypting data.
 //
 // It is up to the consumer of the library to provide callback functions that return the public and private keys. The functions will only be used during read and write operations, not during the building of the pipeline.
@@ -113,6 +273,24 @@ func (p *Pipeline[T]) UseAsymmetricEncryption(publicKeyFn func() *rsa.PublicKey,
 	return p
 }
 
+// Use RSA asymmetric encryption for the fields of T tagged with `otw:"encrypt"`, leaving the rest readable by anything that decodes the message.
+//
+// Only string and []byte fields can be encrypted, and strings are Base64 encoded once encrypted. Build panics if a tagged field has any other type. Writing fails with ErrFieldKeyUnavailable if the public key callback returns nil, while reading leaves the fields encrypted if the private key callback returns nil.
+func (p *Pipeline[T]) UseFieldEncryption(publicKeyFn func() *rsa.PublicKey, privateKeyFn func() *rsa.PrivateKey) *Pipeline[T] {
+	p.readPipeline.UseFieldEncryption(privateKeyFn)
+	p.writePipeline.UseFieldEncryption(publicKeyFn)
+	return p
+}
+
+// Use AES-GCM symmetric encryption for the fields of T tagged with `otw:"encrypt"`, leaving the rest readable by anything that decodes the message.
+//
+// The key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. Writing fails with ErrFieldKeyUnavailable if the key callback returns no key, while reading leaves the fields encrypted.
+func (p *Pipeline[T]) UseSymmetricFieldEncryption(keyFn func() []byte) *Pipeline[T] {
+	p.readPipeline.UseSymmetricFieldEncryption(keyFn)
+	p.writePipeline.UseSymmetricFieldEncryption(keyFn)
+	return p
+}
+
 // Use RSA asymmetric encryption for signing and verifying data being sent. The write operation to the pipeline appends a []byte containing the signature. The read operation will cut the signature from the pipeline, verify it, and either continue processing or error if the signature fails to validate.
 //
 // It is up to the consumer of the library to provide callback functions that return the public and private keys. The functions will only be used during read and write operations, not during the building of the pipeline.
@@ -122,6 +300,83 @@ func (p *Pipeline[T]) UseSigning(publicKeyFn func() *rsa.PublicKey, privateKeyFn
 	return p
 }
 
+// Tags each written message with the current version of the schema, and upgrades messages written with older versions to T when reading.
+//
+// The upgrade functions registered with AddSchemaUpgrade decode an older message into its own type and convert it one version at a time. Build panics if the upgrades don't form a chain ending at T, or if the selected encoding cannot decode types other than T.
+func (p *Pipeline[T]) UseSchema(s *Schema) *Pipeline[T] {
+	p.readPipeline.UseSchema(s)
+	p.writePipeline.UseSchemaVersion(s.Version())
+	return p
+}
+
+// Writes a tag identifying the concrete type of each message ahead of it, and reads messages back as the concrete type registered for the tag.
+//
+// This lets T be an interface, so one connection can carry many kinds of message. Writing a type that isn't registered fails with ErrUnregisteredType and reading an unknown tag fails with ErrUnknownTypeTag. Build panics if a registered type cannot be used as T, or if the selected encoding can only decode T itself.
+func (p *Pipeline[T]) UseTypeRegistry(reg *TypeRegistry) *Pipeline[T] {
+	p.readPipeline.UseTypeRegistry(reg)
+	p.writePipeline.UseTypeRegistry(reg)
+	return p
+}
+
+// Checks each decoded value with validate before read returns it. The error returned by validate is returned from read instead of the value.
+//
+// Validators run in the order they were added.
+func (p *Pipeline[T]) UseValidator(validate func(T) error) *Pipeline[T] {
+	p.readPipeline.UseValidator(validate)
+	return p
+}
+
+// Checks each decoded value against the `validate:"..."` struct tags of T before read returns it, as ValidateStruct does. Failures are returned from read as a *ValidationError listing the path of each invalid field.
+//
+// Build panics if the tags are malformed or don't suit the fields they are on.
+func (p *Pipeline[T]) UseStructValidation() *Pipeline[T] {
+	p.readPipeline.UseStructValidation()
+	return p
+}
+
+// Writes each message as armored text in the given format instead of binary chunks, for transports that only carry text such as chat, email, environment variables or log lines.
+//
+// Lines are wrapped at 64 columns and followed by a CRC-24 checksum line. Armor is always applied to the final bytes, after every other operation, no matter when it is added. Reading ignores extra whitespace and fails with ErrArmorChecksum if the message was altered.
+func (p *Pipeline[T]) UseArmor(format ArmorFormat) *Pipeline[T] {
+	p.readPipeline.UseArmor(format)
+	p.writePipeline.UseArmor(format)
+	return p
+}
+
+// Limits the messages read to at most n bytes as they are sent, before read operations such as decompression. Writing is not limited.
+//
+// Reading fails with ErrMessageTooLarge as soon as a message is known to be larger, before the memory for it is allocated, so a peer cannot exhaust memory by claiming or sending an enormous message. The rest of that message is left unread, so the stream should be closed.
+func (p *Pipeline[T]) UseMaxMessageSize(n int) *Pipeline[T] {
+	p.readPipeline.UseMaxMessageSize(n)
+	return p
+}
+
+// Writes messages in chunks of up to n bytes rather than the default of 1024. Each chunk is written to the io.Writer with a single call, so larger chunks mean fewer calls and less length overhead for large messages. Readers accept any chunk size, so only the writer needs to change.
+//
+// Build panics if n is less than 1 or 2^24 or more.
+func (p *Pipeline[T]) UseChunkSize(n int) *Pipeline[T] {
+	p.writePipeline.UseChunkSize(n)
+	return p
+}
+
+// Writes and reads the length of each chunk as an unsigned varint instead of 4 bytes, which takes 1 or 2 bytes for chunks of up to 16KB.
+//
+// Messages start with a marker byte so the reader can confirm the framing matches, failing with ErrFramingMismatch if only one end uses varint lengths. Armored messages have no chunks, so this has no effect on them.
+func (p *Pipeline[T]) UseVarintLengths() *Pipeline[T] {
+	p.readPipeline.UseVarintLengths()
+	p.writePipeline.UseVarintLengths()
+	return p
+}
+
+// Starts each message with a header describing the encoding and operations used to write it, so reading a message written by a different pipeline fails with ErrPipelineMismatch instead of an error from whichever step fails first.
+//
+// Both ends must use the frame header.
+func (p *Pipeline[T]) UseFrameHeader() *Pipeline[T] {
+	p.readPipeline.UseFrameHeader()
+	p.writePipeline.UseFrameHeader()
+	return p
+}
+
 // Enables a timeout on all operations. This timeout is used for each operation, as well as encoding and decoding the initial and final payloads.
 func (p *Pipeline[T]) UseTimeout(t time.Duration) *Pipeline[T] {
 	p.readPipeline.UseTimeout(t)
@@ -137,77 +392,273 @@ func (p *Pipeline[T]) UseNonce(set func() int, check func(int) bool) *Pipeline[T
 }
 
 // Compiles the pipline into a read func following the specification of the pipeline operations and selected encoders.
+//
+// Build panics if the selected decoder cannot handle R, such as when fixed-layout binary encoding is used with a variable size type or raw encoding with a type that isn't a []byte, string or io.Reader.
 func (p *ReadPipeline[R]) Build() func(io.Reader) (R, error) {
 	logger.Info("Building read pipeline", "NumberOfReadOperations", len(p.readOperations))
-	if p.decoder == nil {
-		logger.Warn("No encoding selected, defaulting to Gob Encoding")
-		p.decoder = gobDecode
+	if p.decoderErr != nil {
+		logger.Error("Failed to build read pipeline. The selected decoder cannot be used", "Error", p.decoderErr)
+		panic(p.decoderErr)
+	}
+
+	if p.operationErr != nil {
+		logger.Error("Failed to build read pipeline. An operation cannot be used", "Error", p.operationErr)
+		panic(p.operationErr)
+	}
+
+	if p.validatorErr != nil {
+		logger.Error("Failed to build read pipeline. The validation tags cannot be used", "Error", p.validatorErr)
+		panic(p.validatorErr)
+	}
+
+	if p.decoder == nil && p.newStreamDecoder == nil {
+		if _, decoder, err := rawCoder[R](); err == nil {
+			logger.Info("No encoding selected, defaulting to Raw Encoding", "Type", reflect.TypeFor[R]())
+			p.decoder = decoder
+			p.codec = codecRaw
+		} else {
+			logger.Warn("No encoding selected, defaulting to Gob Encoding")
+			p.decoder = gobDecode
+			p.unmarshal = gobUnmarshal
+			p.codec = codecGob
+		}
+	}
+
+	decoder := p.decoder
+	newStreamDecoder := p.newStreamDecoder
+	if newStreamDecoder != nil {
+		newStreamDecoder = streamStateDecoder(newStreamDecoder)
+	}
+	if p.typeRegistry != nil {
+		if err := p.typeRegistry.check(reflect.TypeFor[R](), p.unmarshal != nil); err != nil {
+			logger.Error("Failed to build read pipeline. The type registry cannot be used", "Error", err)
+			panic(err)
+		}
+
+		decoder = typeRegistryDecoder[R](p.typeRegistry, p.unmarshal)
+		newStreamDecoder = nil
+	}
+
+	if p.schema != nil {
+		if err := p.schema.check(reflect.TypeFor[R](), p.unmarshal != nil); err != nil {
+			logger.Error("Failed to build read pipeline. The schema cannot be used", "Error", err)
+			panic(err)
+		}
+
+		// Older versions are decoded as the type their upgrade expects, rather than the type now registered for their tag
+		unmarshal := p.unmarshal
+		if p.typeRegistry != nil {
+			unmarshal = skipTypeTag(p.unmarshal)
+		}
+
+		if decoder != nil {
+			decoder = schemaDecoder(p.schema, decoder, unmarshal)
+		}
+		if newStreamDecoder != nil {
+			newUnversionedDecoder := newStreamDecoder
+			newStreamDecoder = func() func([]byte) (R, error) {
+				return schemaDecoder(p.schema, newUnversionedDecoder(), unmarshal)
+			}
+		}
+	}
+
+	if p.fieldCipher != nil {
+		if _, err := checkFieldEncryption(reflect.TypeFor[R]()); err != nil {
+			logger.Error("Failed to build read pipeline. The encrypted fields cannot be used", "Error", err)
+			panic(err)
+		}
+
+		if decoder != nil {
+			decoder = fieldDecryptDecoder(p.fieldCipher, decoder)
+		}
+		if newStreamDecoder != nil {
+			newEncryptedDecoder := newStreamDecoder
+			newStreamDecoder = func() func([]byte) (R, error) {
+				return fieldDecryptDecoder(p.fieldCipher, newEncryptedDecoder())
+			}
+		}
+	}
+
+	var expectedHeader frameHeader
+	if p.useFrameHeader {
+		var flags byte
+		if p.schema != nil {
+			flags |= frameFlagSchema
+		}
+		if p.typeRegistry != nil {
+			flags |= frameFlagTypeRegistry
+		}
+
+		header, err := newFrameHeader(p.codec, flags, p.readOperations)
+		if err != nil {
+			logger.Error("Failed to build read pipeline. The frame header cannot be used", "Error", err)
+			panic(err)
+		}
+		expectedHeader = header
 	}
 
 	slices.Reverse(p.readOperations)
 
 	logger.Debug("Building Read function")
 
-	rlv := conditionalAddTimeoutReader(p.useTimeout, readLV, p.timeoutDuration)
+	rlv := func(r io.Reader, limit int, first bool) ([]byte, int, error) {
+		return conditionalAddTimeoutReader(p.useTimeout, func(r io.Reader) ([]byte, int, error) {
+			return readChunk(r, limit, p.varintLengths, first)
+		}, p.timeoutDuration)(r)
+	}
+
+	readFrame := readChunked(rlv, p.maxMessageSize)
+	if p.useArmor {
+		readArmor := conditionalAddTimeoutReader(p.useTimeout, readArmored(p.armorFormat, p.maxMessageSize), p.timeoutDuration)
+		readFrame = func(r io.Reader) ([]byte, error) {
+			data, _, err := readArmor(r)
+			return data, err
+		}
+	}
+
+	var decoders *streamScope[func([]byte) (R, error)]
+	if newStreamDecoder != nil {
+		decoders = newStreamScope(newStreamDecoder)
+	}
+
+	operations := newOperationScopes(p.readOperations)
 
 	readFn := func(r io.Reader) (R, error) {
 		t := *new(R)
 
-		buffer := bytes.NewBuffer(nil)
+		decoder := decoder
+		if decoders != nil {
+			decoder = decoders.get(r)
+		}
 
-		logger.Debug("Beginning to read chunks...")
-		for {
-			bufferSection, n, err := rlv(r)
+		data, err := readFrame(r)
+		if err != nil {
+			return t, streamStateError{err: err}
+		}
+
+		if p.useFrameHeader {
+			data, err = checkFrameHeader(expectedHeader, data)
 			if err != nil {
-				logger.Error("Failed to read chunk", "Error", err)
 				return t, err
 			}
-
-			if len(bufferSection) == 0 {
-				break
-			}
-
-			buffer.Write(bufferSection)
-			logger.Debug("Read chunk bytes", "ByteCount", n)
 		}
 
 		logger.Debug("Beginning read operations")
-		data := buffer.Bytes()
-		for _, operation := range p.readOperations {
+		for i, operation := range operations.get(r) {
 			d, err := operation(data)
 			if err != nil {
 				logger.Error("Failed to complete read pipeline. An operation failed", "Error", err)
+				if operations.hasState(i) {
+					return t, streamStateError{err: err}
+				}
 				return t, err
 			}
 			data = d
 		}
 
-		t, err := p.decoder(data)
+		t, err = decoder(data)
 		if err != nil {
 			logger.Error("Failed to decode final bytes as required type", "Error", err)
 			return t, err
 		}
 
+		for _, validate := range p.validators {
+			if err := validate(t); err != nil {
+				logger.Error("Failed to validate decoded value", "Error", err)
+				return *new(R), err
+			}
+		}
+
 		logger.Debug("Completed reading")
 		return t, nil
 	}
 
-	return readFn
+	if decoders != nil {
+		p.streams.add(decoders.release)
+	}
+	if operations.stateful {
+		p.streams.add(operations.release)
+	}
+
+	// Only failures of the stream itself discard its state. The writer keeps its state after a message is rejected once decoded, so the reader must too
+	return func(r io.Reader) (R, error) {
+		t, err := readFn(r)
+		if stateErr, ok := err.(streamStateError); ok {
+			if decoders != nil {
+				decoders.release(r)
+			}
+			operations.release(r)
+			return t, stateErr.err
+		}
+		return t, err
+	}
+}
+
+// Discards the state kept for r by the read funcs built from this pipeline, such as Gob stream decoders or stream decompression contexts.
+//
+// Call it once r is finished with, such as when a connection is closed. Otherwise the state, and r itself, is kept until reading from r fails in a way that leaves the stream unusable, such as a frame being cut short. Messages that are rejected once decoded, such as by a validator, keep the state.
+func (p *ReadPipeline[R]) Release(r io.Reader) {
+	p.streams.release(r)
 }
 
 // Custom Operations allow the consumer to define their own read operations to append to the pipeline.
 //
 // Functions take in a []byte and output a modified []byte or error. It is ok to return a new []byte or modify the existing one.
 func (p *ReadPipeline[R]) UseCustomOperation(readFn func([]byte) ([]byte, error)) *ReadPipeline[R] {
-	p.readOperations = append(p.readOperations, conditionalAddTimeout(p.useTimeout, readFn, p.timeoutDuration))
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationCustom}, apply: conditionalAddTimeout(p.useTimeout, readFn, p.timeoutDuration)})
 	return p
 }
 
 // Appends a decompression step to the read operations.
 //
-// Compression is done with the `compress/zlib` library.
-func (p *ReadPipeline[R]) UseCompression() *ReadPipeline[R] {
-	p.readOperations = append(p.readOperations, conditionalAddTimeout(p.useTimeout, decompress, p.timeoutDuration))
+// Compression is done with the `compress/zlib` library. Options such as MaxDecompressedSize and MaxCompressionRatio cause reading to fail with ErrDecompressedTooLarge, rather than exhausting memory, when a payload decompresses to an excessive size.
+func (p *ReadPipeline[R]) UseCompression(opts ...DecompressionOption) *ReadPipeline[R] {
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationCompression}, apply: conditionalAddTimeout(p.useTimeout, decompress(newDecompressionLimits(opts)), p.timeoutDuration)})
+	return p
+}
+
+// Appends a decompression step using c to the read operations.
+//
+// Reading data compressed with a different compressor fails with ErrCompressionMismatch. Options limit the decompressed size as they do for UseCompression.
+func (p *ReadPipeline[R]) UseCompressionWith(c Compressor, opts ...DecompressionOption) *ReadPipeline[R] {
+	if err := checkCompressor(c); err != nil {
+		p.operationErr = err
+	}
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationCompressionWith, compressorID: c.ID()}, apply: conditionalAddTimeout(p.useTimeout, decompressWith(c, newDecompressionLimits(opts)), p.timeoutDuration)})
+	return p
+}
+
+// Appends a decompression step to the read operations for data written with UseAdaptiveCompression. Data is only decompressed if the writer compressed it, so minSize doesn't need to match the writer.
+//
+// This is the same as UseCompressionWith(AdaptiveCompressor(ZlibCompressor(zlib.DefaultCompression), minSize)).
+func (p *ReadPipeline[R]) UseAdaptiveCompression(minSize int) *ReadPipeline[R] {
+	return p.UseCompressionWith(AdaptiveCompressor(ZlibCompressor(zlib.DefaultCompression), minSize))
+}
+
+// Appends a decompression step to the read operations for data written with UseDictionaryCompression. Data can be read if it was compressed with any of dicts, otherwise reading fails with ErrUnknownDictionary.
+//
+// This is the same as UseCompressionWith(DictionaryCompressor(zlib.DefaultCompression, dicts...)). Build panics if no dictionaries are given.
+func (p *ReadPipeline[R]) UseDictionaryCompression(dicts ...[]byte) *ReadPipeline[R] {
+	return p.UseCompressionWith(DictionaryCompressor(zlib.DefaultCompression, dicts...))
+}
+
+// Appends an LZ4 decompression step to the read operations.
+//
+// This is the same as UseCompressionWith(LZ4Compressor()).
+func (p *ReadPipeline[R]) UseLZ4Compression() *ReadPipeline[R] {
+	return p.UseCompressionWith(LZ4Compressor())
+}
+
+// Appends a decompression step to the read operations for data written with UseStreamCompression, keeping the history of earlier messages for the lifetime of each io.Reader.
+//
+// The state for a stream is discarded if a read from it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept. Options limit the decompressed size as they do for UseCompression, though stream compressed messages can have very high ratios when they repeat earlier ones.
+func (p *ReadPipeline[R]) UseStreamCompression(opts ...DecompressionOption) *ReadPipeline[R] {
+	useTimeout, timeoutDuration := p.useTimeout, p.timeoutDuration
+	newDecompressor := flateStreamDecompressor(newDecompressionLimits(opts))
+
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationStreamCompression}, newStream: func() func([]byte) ([]byte, error) {
+		return conditionalAddTimeout(useTimeout, newDecompressor(), timeoutDuration)
+	}})
 	return p
 }
 
@@ -215,21 +666,96 @@ func (p *ReadPipeline[R]) UseCompression() *ReadPipeline[R] {
 //
 // Gob Encoding requires that structs export their fields to be transmitted. No exported fields will result in an error on write.
 func (p *ReadPipeline[R]) UseGobEncoding() *ReadPipeline[R] {
-	p.decoder = gobDecode
+	return p.useDecoder(codecGob, gobDecode, gobUnmarshal, nil)
+}
+
+// Enables off-boarding from the pipeline using Go Object Encoding, with the decoder kept for the lifetime of each io.Reader.
+//
+// Type descriptors are only expected with the first message on a stream. The state for a stream is discarded if a read from it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept.
+func (p *ReadPipeline[R]) UseGobStreamEncoding() *ReadPipeline[R] {
+	p.useDecoder(codecGobStream, nil, nil, nil)
+	p.newStreamDecoder = gobStreamDecoder[R]
 	return p
 }
 
 // Enables off-boarding from the pipeline using JSON Encoding.
-func (p *ReadPipeline[R]) UseJSONEncoding() *ReadPipeline[R] {
-	p.decoder = jsonDecode
-	return p
+//
+// Options such as JSONDisallowUnknownFields make decoding stricter, so schema drift between services results in an error rather than silently lost data.
+func (p *ReadPipeline[R]) UseJSONEncoding(opts ...JSONOption) *ReadPipeline[R] {
+	return p.useDecoder(codecJSON, jsonDecoder[R](opts...), jsonUnmarshaler(opts...), nil)
+}
+
+// Enables off-boarding from the pipeline without any deserialisation, returning the bytes produced by the operations as R.
+//
+// R must be a []byte, string or io.Reader, otherwise Build will panic. This is selected automatically when no encoding has been chosen and R is one of those types.
+func (p *ReadPipeline[R]) UseRawEncoding() *ReadPipeline[R] {
+	_, decoder, err := rawCoder[R]()
+	return p.useDecoder(codecRaw, decoder, nil, err)
+}
+
+// Enables off-boarding from the pipeline using the unmarshaling methods of R itself, so types control their own wire form.
+//
+// If R implements `encoding.BinaryMarshaler` and `encoding.BinaryUnmarshaler` those are used, otherwise `encoding.TextMarshaler` and `encoding.TextUnmarshaler`. Types implementing neither pair fall back to Gob Encoding.
+func (p *ReadPipeline[R]) UseMarshalerEncoding() *ReadPipeline[R] {
+	_, decoder := marshalerCoder[R]()
+	return p.useDecoder(codecMarshaler, decoder, nil, nil)
+}
+
+// Enables off-boarding from the pipeline using canonical JSON Encoding. Canonical JSON is valid JSON, so this decodes the same way as UseJSONEncoding.
+func (p *ReadPipeline[R]) UseCanonicalJSONEncoding() *ReadPipeline[R] {
+	return p.useDecoder(codecJSON, jsonDecode, jsonUnmarshaler(), nil)
+}
+
+// Enables off-boarding from the pipeline using XML Encoding, backed by `encoding/xml`.
+func (p *ReadPipeline[R]) UseXMLEncoding() *ReadPipeline[R] {
+	return p.useDecoder(codecXML, xmlDecode, xmlUnmarshal, nil)
+}
+
+// Enables off-boarding from the pipeline using MessagePack Encoding.
+//
+// Structs are decoded from maps keyed by field name, which can be overridden with `msgpack:"name,omitempty"` struct tags.
+func (p *ReadPipeline[R]) UseMsgPackEncoding() *ReadPipeline[R] {
+	return p.useDecoder(codecMsgPack, msgpackDecode, msgpackUnmarshal, nil)
+}
+
+// Enables off-boarding from the pipeline using CBOR (RFC 8949) Encoding.
+//
+// Structs are decoded from maps keyed by field name, which can be overridden with `cbor:"name,omitempty"` struct tags.
+func (p *ReadPipeline[R]) UseCBOREncoding() *ReadPipeline[R] {
+	return p.useDecoder(codecCBOR, cborDecode, cborUnmarshal, nil)
+}
+
+// Enables off-boarding from the pipeline using a fixed binary layout with the given byte order, built on `encoding/binary`.
+//
+// R must be plain data: booleans, sized numbers, arrays and structs of those. Integer fields tagged with `otw:"varint"` are read as varints, which also allows `int` and `uint`. Build will panic if R has fields of variable size.
+func (p *ReadPipeline[R]) UseBinaryEncoding(order binary.ByteOrder) *ReadPipeline[R] {
+	_, decoder, err := binaryCoder[R](order)
+	return p.useDecoder(binaryCodec(order), decoder, nil, err)
 }
 
 // Use RSA asymmetric encryption for decrypting data.
 //
 // It is up to the consumer of the library to provide a callback function to return the private key. The functions will only be used during read and write operations, not during the building of the pipeline.
 func (p *ReadPipeline[R]) UseAsymmetricEncryption(privateKeyFn func() *rsa.PrivateKey) *ReadPipeline[R] {
-	p.readOperations = append(p.readOperations, conditionalAddTimeout(p.useTimeout, asymmetricDecrypt(privateKeyFn), p.timeoutDuration))
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationAsymmetricEncryption}, apply: conditionalAddTimeout(p.useTimeout, asymmetricDecrypt(privateKeyFn), p.timeoutDuration)})
+	return p
+}
+
+// Use RSA asymmetric encryption for decrypting the fields of R tagged with `otw:"encrypt"`. Fields are decrypted straight after decoding, before any validators run.
+//
+// If the private key callback returns nil, the fields are left encrypted so the message can still be routed on.
+//
+// RSA encryption can't bind a ciphertext to the field it was written for, so encrypted fields swapped between fields or messages decrypt without error. Use UseSymmetricFieldEncryption where that matters.
+func (p *ReadPipeline[R]) UseFieldEncryption(privateKeyFn func() *rsa.PrivateKey) *ReadPipeline[R] {
+	p.fieldCipher = asymmetricFieldDecrypter(privateKeyFn)
+	return p
+}
+
+// Use AES-GCM symmetric encryption for decrypting the fields of R tagged with `otw:"encrypt"`. Fields are decrypted straight after decoding, before any validators run.
+//
+// If the key callback returns no key, the fields are left encrypted so the message can still be routed on. Reading fails if an encrypted field has been moved to another field.
+func (p *ReadPipeline[R]) UseSymmetricFieldEncryption(keyFn func() []byte) *ReadPipeline[R] {
+	p.fieldCipher = symmetricFieldCipher(keyFn, symmetricOpen)
 	return p
 }
 
@@ -237,7 +763,74 @@ func (p *ReadPipeline[R]) UseAsymmetricEncryption(privateKeyFn func() *rsa.Priva
 //
 // It is up to the consumer of the library to provide callback functions that return the public key. The functions will only be used during read and write operations, not during the building of the pipeline.
 func (p *ReadPipeline[R]) UseSigning(publicKeyFn func() *rsa.PublicKey) *ReadPipeline[R] {
-	p.readOperations = append(p.readOperations, conditionalAddTimeout(p.useTimeout, verify(publicKeyFn), p.timeoutDuration))
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationSigning}, apply: conditionalAddTimeout(p.useTimeout, verify(publicKeyFn), p.timeoutDuration)})
+	return p
+}
+
+// Expects each message to be tagged with a schema version, and upgrades messages written with older versions to R using the upgrade functions registered on the schema.
+//
+// Messages with a version newer than the schema, or older than the oldest upgrade, fail with ErrUnknownSchemaVersion. Build panics if the upgrades don't form a chain ending at R, or if the selected encoding cannot decode types other than R.
+func (p *ReadPipeline[R]) UseSchema(s *Schema) *ReadPipeline[R] {
+	p.schema = s
+	return p
+}
+
+// Reads the type tag ahead of each message and decodes the message as the concrete type registered for it, returned as R.
+//
+// Reading an unknown tag fails with ErrUnknownTypeTag. Build panics if a registered type cannot be used as R, or if the selected encoding can only decode R itself.
+func (p *ReadPipeline[R]) UseTypeRegistry(reg *TypeRegistry) *ReadPipeline[R] {
+	p.typeRegistry = reg
+	return p
+}
+
+// Checks each decoded value with validate before read returns it. The error returned by validate is returned from read instead of the value.
+//
+// Validators run in the order they were added.
+func (p *ReadPipeline[R]) UseValidator(validate func(R) error) *ReadPipeline[R] {
+	p.validators = append(p.validators, validate)
+	return p
+}
+
+// Checks each decoded value against the `validate:"..."` struct tags of R before read returns it, as ValidateStruct does. Failures are returned from read as a *ValidationError listing the path of each invalid field.
+//
+// Build panics if the tags are malformed or don't suit the fields they are on.
+func (p *ReadPipeline[R]) UseStructValidation() *ReadPipeline[R] {
+	if err := checkValidationTags(reflect.TypeFor[R]()); err != nil {
+		p.validatorErr = err
+	}
+	return p.UseValidator(func(r R) error {
+		return ValidateStruct(r)
+	})
+}
+
+// Reads each message as armored text in the given format instead of binary chunks. Whitespace within and around the lines is ignored.
+//
+// Fails with ErrArmorChecksum if the message was altered and ErrArmorMalformed if it isn't valid armor. Since the end of a message is only known from its content, io.Readers that don't implement io.ByteReader are read one byte at a time, so wrap connections in a bufio.Reader.
+func (p *ReadPipeline[R]) UseArmor(format ArmorFormat) *ReadPipeline[R] {
+	p.useArmor = true
+	p.armorFormat = format
+	return p
+}
+
+// Limits the messages read to at most n bytes as they are sent, before read operations such as decompression. For armored messages the limit applies to the decoded bytes.
+//
+// Reading fails with ErrMessageTooLarge as soon as a message is known to be larger, checking the length of each chunk against what is left of the limit before allocating for it. The rest of that message is left unread, so the stream should be closed.
+func (p *ReadPipeline[R]) UseMaxMessageSize(n int) *ReadPipeline[R] {
+	p.maxMessageSize = n
+	return p
+}
+
+// Reads the length of each chunk as an unsigned varint instead of 4 bytes, for messages written with UseVarintLengths. Reading fails with ErrFramingMismatch if the writer used the other kind of length.
+func (p *ReadPipeline[R]) UseVarintLengths() *ReadPipeline[R] {
+	p.varintLengths = true
+	return p
+}
+
+// Expects each message to start with the header written by UseFrameHeader, and checks it describes the same encoding and operations, in the same order, as this pipeline before running any of them.
+//
+// Reading fails with ErrPipelineMismatch, saying what differs, if the message was written differently or without a frame header.
+func (p *ReadPipeline[R]) UseFrameHeader() *ReadPipeline[R] {
+	p.useFrameHeader = true
 	return p
 }
 
@@ -250,77 +843,208 @@ func (p *ReadPipeline[R]) UseTimeout(t time.Duration) *ReadPipeline[R] {
 
 // Enables nonces during read operations. An integer nonce is checked for validity using the check callback during reading
 func (p *ReadPipeline[R]) UseNonce(check func(int) bool) *ReadPipeline[R] {
-	p.readOperations = append(p.readOperations, checkNonce(check))
+	p.readOperations = append(p.readOperations, pipelineOperation{code: operationCode{kind: operationNonce}, apply: checkNonce(check)})
+	return p
+}
+
+// Selects the decoder, replacing any previously selected. An error means the decoder cannot handle R, and is reported when building. The codec identifies the encoding in frame headers.
+//
+// The unmarshal func decodes the same encoding into any type, and is used to decode older schema versions. It is nil for encodings that only work for R.
+func (p *ReadPipeline[R]) useDecoder(codec byte, decoder func([]byte) (R, error), unmarshal func([]byte, any) error, err error) *ReadPipeline[R] {
+	p.codec = codec
+	p.decoder = decoder
+	p.unmarshal = unmarshal
+	p.decoderErr = err
+	p.newStreamDecoder = nil
 	return p
 }
 
 // Compiles the pipline into a read func and write func following the specification of the pipeline operations and selected encoders.
+//
+// Build panics if the selected encoder cannot handle W, such as when fixed-layout binary encoding is used with a variable size type or raw encoding with a type that isn't a []byte, string or io.Reader.
 func (p *WritePipeline[W]) Build() func(W, io.Writer) error {
 	logger.Info("Building write pipeline", "NumberOfWriteOperations", len(p.writeOperations))
-	if p.encoder == nil {
-		logger.Warn("No encoding selected, defaulting to Gob Encoding")
-		p.encoder = gobEncode
+	if p.encoderErr != nil {
+		logger.Error("Failed to build write pipeline. The selected encoder cannot be used", "Error", p.encoderErr)
+		panic(p.encoderErr)
+	}
+
+	if p.operationErr != nil {
+		logger.Error("Failed to build write pipeline. An operation cannot be used", "Error", p.operationErr)
+		panic(p.operationErr)
 	}
 
-	wlv := conditionalAddTimeoutWriter(p.useTimeout, writeLV, p.timeoutDuration)
+	if p.encoder == nil && p.newStreamEncoder == nil {
+		if encoder, _, err := rawCoder[W](); err == nil {
+			logger.Info("No encoding selected, defaulting to Raw Encoding", "Type", reflect.TypeFor[W]())
+			p.encoder = encoder
+			p.codec = codecRaw
+		} else {
+			logger.Warn("No encoding selected, defaulting to Gob Encoding")
+			p.encoder = gobEncode
+			p.codec = codecGob
+		}
+	}
+
+	chunkSize := p.chunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	write := func(data []byte, w io.Writer) (int, error) {
+		return writeFull(w, data)
+	}
+	writeFrame := writeChunked(conditionalAddTimeoutWriter(p.useTimeout, write, p.timeoutDuration), chunkSize, p.varintLengths)
+	if p.useArmor {
+		writeArmor := conditionalAddTimeoutWriter(p.useTimeout, writeArmored(p.armorFormat), p.timeoutDuration)
+		writeFrame = func(data []byte, w io.Writer) error {
+			_, err := writeArmor(data, w)
+			return err
+		}
+	}
 
 	logger.Debug("Building Write function")
+	encoder := p.encoder
+	newStreamEncoder := p.newStreamEncoder
+	if newStreamEncoder != nil {
+		newStreamEncoder = streamStateEncoder(newStreamEncoder)
+	}
+	if p.typeRegistry != nil {
+		if encoder != nil {
+			encoder = typeRegistryEncoder(p.typeRegistry, encoder)
+		}
+		if newStreamEncoder != nil {
+			newUntaggedEncoder := newStreamEncoder
+			newStreamEncoder = func() func(W) ([]byte, error) {
+				return typeRegistryEncoder(p.typeRegistry, newUntaggedEncoder())
+			}
+		}
+	}
+
+	// Tags are only checked when field encryption is enabled, so types with tags it can't handle can still be written by pipelines that don't use it
+	hasEncryptedFields, err := checkFieldEncryption(reflect.TypeFor[W]())
+	if p.fieldCipher != nil {
+		if err != nil {
+			logger.Error("Failed to build write pipeline. The encrypted fields cannot be used", "Error", err)
+			panic(err)
+		}
+
+		if encoder != nil {
+			encoder = fieldEncryptEncoder(p.fieldCipher, encoder)
+		}
+		if newStreamEncoder != nil {
+			newPlainEncoder := newStreamEncoder
+			newStreamEncoder = func() func(W) ([]byte, error) {
+				return fieldEncryptEncoder(p.fieldCipher, newPlainEncoder())
+			}
+		}
+	} else if hasEncryptedFields || err != nil {
+		logger.Warn("Fields are tagged for encryption but no field encryption has been enabled, they will be sent unencrypted", "Type", reflect.TypeFor[W]())
+	}
+
+	var header []byte
+	if p.useFrameHeader {
+		var flags byte
+		if p.useSchema {
+			flags |= frameFlagSchema
+		}
+		if p.typeRegistry != nil {
+			flags |= frameFlagTypeRegistry
+		}
+
+		h, err := newFrameHeader(p.codec, flags, p.writeOperations)
+		if err != nil {
+			logger.Error("Failed to build write pipeline. The frame header cannot be used", "Error", err)
+			panic(err)
+		}
+		header = h.bytes()
+	}
+
+	var encoders *streamScope[func(W) ([]byte, error)]
+	if newStreamEncoder != nil {
+		encoders = newStreamScope(newStreamEncoder)
+	}
+
+	operations := newOperationScopes(p.writeOperations)
+
 	writeFn := func(t W, w io.Writer) error {
-		encoded, err := p.encoder(t)
+		encoder := encoder
+		if encoders != nil {
+			encoder = encoders.get(w)
+		}
+
+		encoded, err := encoder(t)
 		if err != nil {
 			logger.Error("Failed to onboard data into write pipeline", "Error", err, "Type", reflect.TypeOf(t))
 			return err
 		}
 
+		if p.useSchema {
+			encoded = append(intToBytes(p.schemaVersion), encoded...)
+		}
+
+		// Once per-stream state has taken in the message, the reader must receive it to stay in step
+		advanced := encoders != nil
+
 		logger.Debug("Beginning write operations...")
 		data := encoded
-		for _, operation := range p.writeOperations {
+		for i, operation := range operations.get(w) {
 			data, err = operation(data)
 			if err != nil {
 				logger.Error("Failed to complete write pipeline. An operation failed")
+				if advanced || operations.hasState(i) {
+					return streamStateError{err: err}
+				}
 				return err
 			}
+			advanced = advanced || operations.hasState(i)
 		}
 
-		logger.Debug("Beginning chunked writes...")
-		for i := 0; i < len(data); i += 1024 {
-			start := i
-			end := i + 1024
-
-			written := 0
-			if end >= len(data) {
-				logger.Debug("Writing last chunk...")
-				written, err = wlv(data[start:], w)
-			} else {
-				logger.Debug("Writing chunk...")
-				written, err = wlv(data[start:end], w)
-			}
-
-			if err != nil {
-				logger.Error("Failed to write chunk", "Error", err)
-				return err
-			}
-			logger.Debug("Written bytes", "ByteCount", written)
+		if header != nil {
+			data = slices.Concat(header, data)
 		}
 
-		// Write empty buffer to indicate to stop buffering
-		if _, err := wlv([]byte{}, w); err != nil {
-			logger.Error("Failed to write stop chunk", "Error", err)
-			return err
+		if err := writeFrame(data, w); err != nil {
+			return streamStateError{err: err}
 		}
 
 		logger.Debug("Completed writing")
 		return nil
 	}
 
-	return writeFn
+	if encoders != nil {
+		p.streams.add(encoders.release)
+	}
+	if operations.stateful {
+		p.streams.add(operations.release)
+	}
+
+	// Only failures that leave the reader out of step discard the state for the stream, so rejected values don't force the stream to start afresh
+	return func(t W, w io.Writer) error {
+		err := writeFn(t, w)
+		if stateErr, ok := err.(streamStateError); ok {
+			if encoders != nil {
+				encoders.release(w)
+			}
+			operations.release(w)
+			return stateErr.err
+		}
+		return err
+	}
+}
+
+// Discards the state kept for w by the write funcs built from this pipeline, such as Gob stream encoders or stream compression contexts.
+//
+// Call it once w is finished with, such as when a connection is closed. Otherwise the state, and w itself, is kept until writing to w fails in a way that leaves the reader out of step, such as the frame not being written.
+func (p *WritePipeline[W]) Release(w io.Writer) {
+	p.streams.release(w)
 }
 
 // Custom Operations allow the consumer to define their own write operations to append to the pipeline.
 //
 // Functions take in a []byte and output a modified []byte or error. It is ok to return a new []byte or modify the existing one.
 func (p *WritePipeline[W]) UseCustomOperation(writeFn func([]byte) ([]byte, error)) *WritePipeline[W] {
-	p.writeOperations = append(p.writeOperations, conditionalAddTimeout(p.useTimeout, writeFn, p.timeoutDuration))
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationCustom}, apply: conditionalAddTimeout(p.useTimeout, writeFn, p.timeoutDuration)})
 	return p
 }
 
@@ -328,7 +1052,56 @@ func (p *WritePipeline[W]) UseCustomOperation(writeFn func([]byte) ([]byte, erro
 //
 // Compression is done with the `compress/zlib` library.
 func (p *WritePipeline[W]) UseCompression() *WritePipeline[W] {
-	p.writeOperations = append(p.writeOperations, conditionalAddTimeout(p.useTimeout, compress, p.timeoutDuration))
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationCompression}, apply: conditionalAddTimeout(p.useTimeout, compress, p.timeoutDuration)})
+	return p
+}
+
+// Appends a compression step using c to the write operations. The ID of the compressor is written ahead of the compressed data.
+//
+// Build panics if c cannot be used, such as when it was given an invalid level.
+func (p *WritePipeline[W]) UseCompressionWith(c Compressor) *WritePipeline[W] {
+	if err := checkCompressor(c); err != nil {
+		p.operationErr = err
+	}
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationCompressionWith, compressorID: c.ID()}, apply: conditionalAddTimeout(p.useTimeout, compressWith(c), p.timeoutDuration)})
+	return p
+}
+
+// Appends a zlib compression step to the write operations that stores payloads uncompressed when they are smaller than minSize or compression doesn't make them smaller.
+//
+// This is the same as UseCompressionWith(AdaptiveCompressor(ZlibCompressor(zlib.DefaultCompression), minSize)).
+func (p *WritePipeline[W]) UseAdaptiveCompression(minSize int) *WritePipeline[W] {
+	return p.UseCompressionWith(AdaptiveCompressor(ZlibCompressor(zlib.DefaultCompression), minSize))
+}
+
+// Appends a zlib compression step to the write operations using the first of dicts as a preset dictionary. The ID of the dictionary is written ahead of the compressed data so the reader can pick the same one.
+//
+// This is the same as UseCompressionWith(DictionaryCompressor(zlib.DefaultCompression, dicts...)). Build panics if no dictionaries are given.
+func (p *WritePipeline[W]) UseDictionaryCompression(dicts ...[]byte) *WritePipeline[W] {
+	return p.UseCompressionWith(DictionaryCompressor(zlib.DefaultCompression, dicts...))
+}
+
+// Appends an LZ4 compression step to the write operations. LZ4 compresses less than zlib but is much faster.
+//
+// This is the same as UseCompressionWith(LZ4Compressor()).
+func (p *WritePipeline[W]) UseLZ4Compression() *WritePipeline[W] {
+	return p.UseCompressionWith(LZ4Compressor())
+}
+
+// Appends a compression step to the write operations that keeps one flate context at the given level for the lifetime of each io.Writer, flushing each message so later messages can refer back to earlier ones.
+//
+// The state for a stream is discarded if a write to it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept. Levels below 7 don't refer back to earlier messages from messages shorter than 128 bytes. Build panics if level is invalid.
+func (p *WritePipeline[W]) UseStreamCompression(level int) *WritePipeline[W] {
+	if err := checkFlateLevel(level); err != nil {
+		p.operationErr = err
+	}
+
+	useTimeout, timeoutDuration := p.useTimeout, p.timeoutDuration
+	newCompressor := flateStreamCompressor(level)
+
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationStreamCompression}, newStream: func() func([]byte) ([]byte, error) {
+		return conditionalAddTimeout(useTimeout, newCompressor(), timeoutDuration)
+	}})
 	return p
 }
 
@@ -336,21 +1109,98 @@ func (p *WritePipeline[W]) UseCompression() *WritePipeline[W] {
 //
 // Gob Encoding requires that structs export their fields to be transmitted. No exported fields will result in an error on write.
 func (p *WritePipeline[W]) UseGobEncoding() *WritePipeline[W] {
-	p.encoder = gobEncode
+	return p.useEncoder(codecGob, gobEncode, nil)
+}
+
+// Enables on-boarding to the pipeline using Go Object Encoding, with the encoder kept for the lifetime of each io.Writer.
+//
+// Type descriptors are only sent with the first message on a stream. The state for a stream is discarded if a write to it fails, as it does when a connection is broken, so a recreated connection starts afresh. Call Release once a stream is finished with, otherwise its state is kept.
+func (p *WritePipeline[W]) UseGobStreamEncoding() *WritePipeline[W] {
+	p.useEncoder(codecGobStream, nil, nil)
+	p.newStreamEncoder = gobStreamEncoder[W]
 	return p
 }
 
 // Enables on-boarding to the pipeline using JSON Encoding.
 func (p *WritePipeline[W]) UseJSONEncoding() *WritePipeline[W] {
-	p.encoder = jsonEncode
-	return p
+	return p.useEncoder(codecJSON, jsonEncode, nil)
+}
+
+// Enables on-boarding to the pipeline without any serialisation, passing the bytes of W straight into the operations.
+//
+// W must be a []byte, string or io.Reader, otherwise Build will panic. This is selected automatically when no encoding has been chosen and W is one of those types.
+func (p *WritePipeline[W]) UseRawEncoding() *WritePipeline[W] {
+	encoder, _, err := rawCoder[W]()
+	return p.useEncoder(codecRaw, encoder, err)
+}
+
+// Enables on-boarding to the pipeline using the marshaling methods of W itself, so types control their own wire form.
+//
+// If W implements `encoding.BinaryMarshaler` and `encoding.BinaryUnmarshaler` those are used, otherwise `encoding.TextMarshaler` and `encoding.TextUnmarshaler`. Types implementing neither pair fall back to Gob Encoding.
+func (p *WritePipeline[W]) UseMarshalerEncoding() *WritePipeline[W] {
+	encoder, _ := marshalerCoder[W]()
+	return p.useEncoder(codecMarshaler, encoder, nil)
+}
+
+// Enables on-boarding to the pipeline using canonical JSON Encoding, in the style of RFC 8785.
+//
+// Object keys are sorted, numbers are normalised and there is no insignificant whitespace, so a peer in another language that re-serialises the JSON produces the same bytes. Integers beyond 2^53 - 1 cannot be represented and fail to encode.
+func (p *WritePipeline[W]) UseCanonicalJSONEncoding() *WritePipeline[W] {
+	return p.useEncoder(codecJSON, canonicalJSONEncode, nil)
+}
+
+// Enables on-boarding to the pipeline using XML Encoding, backed by `encoding/xml`.
+func (p *WritePipeline[W]) UseXMLEncoding() *WritePipeline[W] {
+	return p.useEncoder(codecXML, xmlEncode, nil)
+}
+
+// Enables on-boarding to the pipeline using MessagePack Encoding.
+//
+// Structs are encoded as maps keyed by field name, which can be overridden with `msgpack:"name,omitempty"` struct tags.
+func (p *WritePipeline[W]) UseMsgPackEncoding() *WritePipeline[W] {
+	return p.useEncoder(codecMsgPack, msgpackEncode, nil)
+}
+
+// Enables on-boarding to the pipeline using deterministic CBOR (RFC 8949) Encoding.
+//
+// Encoding follows the core deterministic encoding requirements, so equal values always produce identical bytes. Structs are encoded as maps keyed by field name, which can be overridden with `cbor:"name,omitempty"` struct tags.
+func (p *WritePipeline[W]) UseCBOREncoding() *WritePipeline[W] {
+	return p.useEncoder(codecCBOR, cborEncode, nil)
+}
+
+// Enables on-boarding to the pipeline using a fixed binary layout with the given byte order, built on `encoding/binary`.
+//
+// W must be plain data: booleans, sized numbers, arrays and structs of those. Integer fields tagged with `otw:"varint"` are written as varints, which also allows `int` and `uint`. Build will panic if W has fields of variable size.
+func (p *WritePipeline[W]) UseBinaryEncoding(order binary.ByteOrder) *WritePipeline[W] {
+	encoder, _, err := binaryCoder[W](order)
+	return p.useEncoder(binaryCodec(order), encoder, err)
 }
 
 // Use RSA asymmetric encryption for encrypting data.
 //
 // It is up to the consumer of the library to provide a callback function to return the public key. The function will only be used during write operations, not during the building of the pipeline.
 func (p *WritePipeline[W]) UseAsymmetricEncryption(publicKeyFn func() *rsa.PublicKey) *WritePipeline[W] {
-	p.writeOperations = append(p.writeOperations, conditionalAddTimeout(p.useTimeout, asymmetricEncrypt(publicKeyFn), p.timeoutDuration))
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationAsymmetricEncryption}, apply: conditionalAddTimeout(p.useTimeout, asymmetricEncrypt(publicKeyFn), p.timeoutDuration)})
+	return p
+}
+
+// Use RSA asymmetric encryption for the fields of W tagged with `otw:"encrypt"`. The value passed to write is left untouched.
+//
+// Only string and []byte fields can be encrypted, and strings are Base64 encoded once encrypted. Build panics if a tagged field has any other type. Writing fails with ErrFieldKeyUnavailable if the public key callback returns nil.
+//
+// RSA encryption can't bind a ciphertext to the field it was written for, so encrypted fields swapped between fields or messages decrypt without error. Use UseSymmetricFieldEncryption where that matters.
+func (p *WritePipeline[W]) UseFieldEncryption(publicKeyFn func() *rsa.PublicKey) *WritePipeline[W] {
+	p.fieldCipher = asymmetricFieldEncrypter(publicKeyFn)
+	return p
+}
+
+// Use AES-GCM symmetric encryption for the fields of W tagged with `otw:"encrypt"`. The value passed to write is left untouched.
+//
+// The key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. Writing fails with ErrFieldKeyUnavailable if the key callback returns no key.
+//
+// The path of each field from the value written, such as "Credentials.Token", is authenticated along with it, so an encrypted field moved to another field fails to decrypt.
+func (p *WritePipeline[W]) UseSymmetricFieldEncryption(keyFn func() []byte) *WritePipeline[W] {
+	p.fieldCipher = symmetricFieldCipher(keyFn, symmetricSeal)
 	return p
 }
 
@@ -358,7 +1208,56 @@ func (p *WritePipeline[W]) UseAsymmetricEncryption(publicKeyFn func() *rsa.Publi
 //
 // It is up to the consumer of the library to provide the callback function to return the private key. The function will only be used during write operations, not during the building of the pipeline.
 func (p *WritePipeline[W]) UseSigning(privateKeyFn func() *rsa.PrivateKey) *WritePipeline[W] {
-	p.writeOperations = append(p.writeOperations, conditionalAddTimeout(p.useTimeout, sign(privateKeyFn), p.timeoutDuration))
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationSigning}, apply: conditionalAddTimeout(p.useTimeout, sign(privateKeyFn), p.timeoutDuration)})
+	return p
+}
+
+// Tags each written message with the given schema version, so readers using UseSchema can upgrade it to their own version of the type.
+func (p *WritePipeline[W]) UseSchemaVersion(version int) *WritePipeline[W] {
+	p.useSchema = true
+	p.schemaVersion = version
+	return p
+}
+
+// Writes a tag identifying the concrete type of each message ahead of it, so readers using UseTypeRegistry can decode it as that type.
+//
+// Writing a type that isn't registered fails with ErrUnregisteredType.
+func (p *WritePipeline[W]) UseTypeRegistry(reg *TypeRegistry) *WritePipeline[W] {
+	p.typeRegistry = reg
+	return p
+}
+
+// Writes each message as armored text in the given format instead of binary chunks, for transports that only carry text.
+//
+// Lines are wrapped at 64 columns and followed by a CRC-24 checksum line. Armor is always applied to the final bytes, after every other operation, no matter when it is added.
+func (p *WritePipeline[W]) UseArmor(format ArmorFormat) *WritePipeline[W] {
+	p.useArmor = true
+	p.armorFormat = format
+	return p
+}
+
+// Writes messages in chunks of up to n bytes rather than the default of 1024. Each chunk is written to the io.Writer with a single call, so larger chunks mean fewer calls and less length overhead for large messages.
+//
+// Build panics if n is less than 1 or 2^24 or more.
+func (p *WritePipeline[W]) UseChunkSize(n int) *WritePipeline[W] {
+	if err := checkChunkSize(n); err != nil {
+		p.operationErr = err
+	}
+	p.chunkSize = n
+	return p
+}
+
+// Writes the length of each chunk as an unsigned varint instead of 4 bytes, preceded by a marker byte at the start of each message so the reader can confirm the framing matches.
+func (p *WritePipeline[W]) UseVarintLengths() *WritePipeline[W] {
+	p.varintLengths = true
+	return p
+}
+
+// Starts each message with a header of the magic bytes "OTW", a version and a compact description of the encoding and operations used, so readers using UseFrameHeader can confirm they match.
+//
+// The header is written after every operation, so it is not compressed, encrypted or signed. Build panics if there are more than 255 operations.
+func (p *WritePipeline[W]) UseFrameHeader() *WritePipeline[W] {
+	p.useFrameHeader = true
 	return p
 }
 
@@ -371,6 +1270,15 @@ func (p *WritePipeline[W]) UseTimeout(t time.Duration) *WritePipeline[W] {
 
 // Enables nonces during read operations. An integer nonce is checked for validity using the check callback during reading
 func (p *WritePipeline[W]) UseNonce(set func() int) *WritePipeline[W] {
-	p.writeOperations = append(p.writeOperations, setNonce(set))
+	p.writeOperations = append(p.writeOperations, pipelineOperation{code: operationCode{kind: operationNonce}, apply: setNonce(set)})
+	return p
+}
+
+// Selects the encoder, replacing any previously selected. An error means the encoder cannot handle W, and is reported when building. The codec identifies the encoding in frame headers.
+func (p *WritePipeline[W]) useEncoder(codec byte, encoder func(W) ([]byte, error), err error) *WritePipeline[W] {
+	p.codec = codec
+	p.encoder = encoder
+	p.encoderErr = err
+	p.newStreamEncoder = nil
 	return p
 }
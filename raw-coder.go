@@ -0,0 +1,63 @@
+package onthewire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var (
+	bytesType  = reflect.TypeFor[[]byte]()
+	readerType = reflect.TypeFor[io.Reader]()
+)
+
+// Builds an encoder and decoder that pass T straight into and out of the operations without serialisation, or returns an error if T is not a []byte, string or io.Reader.
+func rawCoder[T any]() (func(T) ([]byte, error), func([]byte) (T, error), error) {
+	typ := reflect.TypeFor[T]()
+
+	isReader := typ == readerType
+	// Slices of named byte types, such as []MyByte, can't be converted to and from []byte, so aren't raw
+	isBytes := typ.Kind() == reflect.Slice && typ.ConvertibleTo(bytesType) && bytesType.ConvertibleTo(typ)
+	isString := typ.Kind() == reflect.String
+
+	if !isReader && !isBytes && !isString {
+		return nil, nil, fmt.Errorf("raw: %s is not a []byte, string or io.Reader", typ)
+	}
+
+	encode := func(t T) ([]byte, error) {
+		var encoded []byte
+
+		if isReader {
+			reader, _ := any(t).(io.Reader)
+			if reader != nil {
+				data, err := io.ReadAll(reader)
+				if err != nil {
+					logger.Error("Failed to read raw data from reader", "Error", err)
+					return nil, err
+				}
+				encoded = data
+			}
+		} else {
+			encoded = reflect.ValueOf(t).Convert(bytesType).Bytes()
+		}
+
+		logger.Debug("Raw encoded", "Type", typ, "ByteCount", len(encoded), "Bytes", logBytes(encoded, typ))
+		return encoded, nil
+	}
+
+	decode := func(data []byte) (T, error) {
+		var t T
+
+		if isReader {
+			t = any(bytes.NewReader(data)).(T)
+		} else {
+			t = reflect.ValueOf(data).Convert(typ).Interface().(T)
+		}
+
+		logger.Debug("Raw decoded", "Type", typ, "ByteCount", len(data))
+		return t, nil
+	}
+
+	return encode, decode, nil
+}
@@ -0,0 +1,166 @@
+package onthewire
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+var payloadLogging atomic.Bool
+
+func init() {
+	payloadLogging.Store(true)
+}
+
+// Enables or disables logging of full payloads at Debug level. Payload logging is enabled by default.
+//
+// When disabled, encoded bytes and decoded values are logged as a summary of their type and size instead. Fields tagged with `otw:"secret"` are always redacted, whether or not payload logging is enabled.
+func SetPayloadLogging(enabled bool) {
+	payloadLogging.Store(enabled)
+}
+
+// Logs encoded bytes of a value of type typ. The bytes are summarised if payload logging is disabled or the type may hold secret fields, including through interface fields, since secrets can't be picked out of the encoded bytes.
+type loggedBytes struct {
+	data []byte
+	typ  reflect.Type
+}
+
+func logBytes(data []byte, typ reflect.Type) loggedBytes {
+	return loggedBytes{data: data, typ: typ}
+}
+
+func (b loggedBytes) LogValue() slog.Value {
+	if info := secretsFor(b.typ); !payloadLogging.Load() || info.secret || info.dynamic {
+		return slog.StringValue(fmt.Sprintf("%s (%d bytes)", redacted, len(b.data)))
+	}
+	return slog.AnyValue(b.data)
+}
+
+// Logs a decoded value, replacing fields tagged with `otw:"secret"` with a placeholder.
+type loggedInstance struct {
+	value any
+}
+
+func logInstance(v any) loggedInstance {
+	return loggedInstance{value: v}
+}
+
+func (i loggedInstance) LogValue() slog.Value {
+	v := reflect.ValueOf(i.value)
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+
+	if !payloadLogging.Load() {
+		return slog.StringValue(fmt.Sprintf("%s (%s)", redacted, v.Type()))
+	}
+	return redactedValue(v)
+}
+
+// Interfaces are redacted based on the value they hold, since their type says nothing about whether it has secret fields.
+func redactedValue(v reflect.Value) slog.Value {
+	if info := secretsFor(v.Type()); !info.secret && !info.dynamic {
+		return slog.AnyValue(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		return redactedValue(v.Elem())
+	case reflect.Slice, reflect.Array:
+		attrs := make([]slog.Attr, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			attrs = append(attrs, slog.Attr{Key: strconv.Itoa(i), Value: redactedValue(v.Index(i))})
+		}
+		return slog.GroupValue(attrs...)
+	case reflect.Map:
+		attrs := make([]slog.Attr, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			attrs = append(attrs, slog.Attr{Key: fmt.Sprint(iter.Key()), Value: redactedValue(iter.Value())})
+		}
+		return slog.GroupValue(attrs...)
+	default:
+		t := v.Type()
+		attrs := make([]slog.Attr, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			if hasOTWOption(f, "secret") {
+				attrs = append(attrs, slog.String(f.Name, redacted))
+			} else {
+				attrs = append(attrs, slog.Attr{Key: f.Name, Value: redactedValue(v.Field(i))})
+			}
+		}
+		return slog.GroupValue(attrs...)
+	}
+}
+
+// Describes whether values of a type have fields tagged with `otw:"secret"`, and whether they have interfaces which may hold values that do.
+type secrets struct {
+	secret  bool
+	dynamic bool
+}
+
+var secretsCache sync.Map
+
+// Looks for fields tagged with `otw:"secret"` in t, including within nested structs, pointers, slices and maps.
+func secretsFor(t reflect.Type) secrets {
+	if t == nil {
+		return secrets{}
+	}
+
+	if cached, ok := secretsCache.Load(t); ok {
+		return cached.(secrets)
+	}
+
+	info := findSecrets(t, make(map[reflect.Type]bool))
+	secretsCache.Store(t, info)
+	return info
+}
+
+func findSecrets(t reflect.Type, seen map[reflect.Type]bool) secrets {
+	if seen[t] {
+		return secrets{}
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return secrets{dynamic: true}
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return findSecrets(t.Elem(), seen)
+	case reflect.Map:
+		key, elem := findSecrets(t.Key(), seen), findSecrets(t.Elem(), seen)
+		return secrets{secret: key.secret || elem.secret, dynamic: key.dynamic || elem.dynamic}
+	case reflect.Struct:
+		var info secrets
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			if hasOTWOption(f, "secret") {
+				info.secret = true
+				continue
+			}
+
+			field := findSecrets(f.Type, seen)
+			info.secret = info.secret || field.secret
+			info.dynamic = info.dynamic || field.dynamic
+		}
+		return info
+	}
+	return secrets{}
+}
@@ -0,0 +1,133 @@
+package onthewire
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+var (
+	ErrUnknownSchemaVersion = fmt.Errorf("schema version is unknown")
+	ErrSchemaVersionMissing = fmt.Errorf("schema version is missing from message")
+)
+
+// Describes the current version of a message type and how messages written with older versions are upgraded to it.
+//
+// Create one with NewSchema and register an upgrade for each older version with AddSchemaUpgrade.
+type Schema struct {
+	version  int
+	upgrades map[int]schemaUpgrade
+}
+
+type schemaUpgrade struct {
+	from    reflect.Type
+	to      reflect.Type
+	upgrade func(any) (any, error)
+}
+
+// Creates a schema whose current version is the given version. Messages are written with this version and read without any upgrades.
+func NewSchema(version int) *Schema {
+	return &Schema{
+		version:  version,
+		upgrades: make(map[int]schemaUpgrade),
+	}
+}
+
+// Returns the current version of the schema.
+func (s *Schema) Version() int {
+	return s.version
+}
+
+// Registers the upgrade of a message written with fromVersion, decoded as From, to the next version To.
+//
+// Upgrades are applied one version at a time, so a v1 message is upgraded by the v1 function, then the v2 function, and so on until it reaches the current version. Registering an upgrade for a version again replaces it.
+func AddSchemaUpgrade[From, To any](s *Schema, fromVersion int, upgrade func(From) (To, error)) *Schema {
+	s.upgrades[fromVersion] = schemaUpgrade{
+		from: reflect.TypeFor[From](),
+		to:   reflect.TypeFor[To](),
+		upgrade: func(v any) (any, error) {
+			return upgrade(v.(From))
+		},
+	}
+	return s
+}
+
+// Checks that the upgrades form an unbroken chain from the oldest version to the current version, ending at target.
+func (s *Schema) check(target reflect.Type, canUnmarshal bool) error {
+	if len(s.upgrades) == 0 {
+		return nil
+	}
+
+	if !canUnmarshal {
+		return fmt.Errorf("schema: the selected encoding cannot decode older versions of %s", target)
+	}
+
+	versions := make([]int, 0, len(s.upgrades))
+	for version := range s.upgrades {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+
+	for version := versions[0]; version < s.version; version++ {
+		step, ok := s.upgrades[version]
+		if !ok {
+			return fmt.Errorf("schema: no upgrade from version %d to %d", version, version+1)
+		}
+
+		next := target
+		if version+1 < s.version {
+			next = s.upgrades[version+1].from
+		}
+		if step.to != next {
+			return fmt.Errorf("schema: upgrade from version %d returns %s but version %d is %s", version, step.to, version+1, next)
+		}
+	}
+
+	if last := versions[len(versions)-1]; last >= s.version {
+		return fmt.Errorf("schema: upgrade from version %d is not older than the current version %d", last, s.version)
+	}
+
+	return nil
+}
+
+// Wraps decoder to read the schema version from the front of each message, upgrading older versions to R.
+func schemaDecoder[R any](s *Schema, decoder func([]byte) (R, error), unmarshal func([]byte, any) error) func([]byte) (R, error) {
+	return func(data []byte) (R, error) {
+		if len(data) < 4 {
+			logger.Error("Failed to read schema version", "Error", ErrSchemaVersionMissing)
+			return *new(R), ErrSchemaVersionMissing
+		}
+
+		version := bytesToInt(data[:4])
+		payload := data[4:]
+
+		if version == s.version {
+			return decoder(payload)
+		}
+
+		step, ok := s.upgrades[version]
+		if !ok || version > s.version {
+			logger.Error("Failed to read message. The schema version is unknown", "Version", version, "CurrentVersion", s.version)
+			return *new(R), fmt.Errorf("%w: version %d, current version %d", ErrUnknownSchemaVersion, version, s.version)
+		}
+
+		old := reflect.New(step.from)
+		if err := unmarshal(payload, old.Interface()); err != nil {
+			logger.Error("Failed to decode message with older schema version", "Version", version, "Type", step.from, "Error", err)
+			return *new(R), err
+		}
+
+		value := old.Elem().Interface()
+		for ; version < s.version; version++ {
+			upgraded, err := s.upgrades[version].upgrade(value)
+			if err != nil {
+				logger.Error("Failed to upgrade message", "Version", version, "Error", err)
+				return *new(R), err
+			}
+			value = upgraded
+		}
+
+		logger.Debug("Upgraded message to current schema version", "Version", s.version, "Type", reflect.TypeFor[R]())
+		return value.(R), nil
+	}
+}
@@ -0,0 +1,103 @@
+package onthewire
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	flateStreamID   byte = 7
+	flateWindowSize      = 32 * 1024
+)
+
+// Flushing leaves this marker at the end of every message. It is left off the wire and restored when reading, as WebSocket permessage-deflate does.
+var flateSyncMarker = []byte{0x00, 0x00, 0xff, 0xff}
+
+// An empty final block, appended when reading so the decompressor sees the end of each message.
+var flateFinalBlock = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+// Reports an error if level is not a valid `compress/flate` level.
+func checkFlateLevel(level int) error {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return fmt.Errorf("stream compression cannot be used: %w", err)
+	}
+	return nil
+}
+
+// Creates the compression step for a stream. One flate context is kept for the stream and each message is flushed, so later messages can refer back to the content of earlier ones.
+func flateStreamCompressor(level int) func() func([]byte) ([]byte, error) {
+	return func() func([]byte) ([]byte, error) {
+		var mu sync.Mutex
+		buffer := bytes.NewBuffer(nil)
+		compressor, compressorErr := flate.NewWriter(buffer, level)
+
+		return func(data []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if compressorErr != nil {
+				logger.Error("Failed to create stream compressor", "Error", compressorErr)
+				return nil, compressorErr
+			}
+
+			buffer.Reset()
+			buffer.WriteByte(flateStreamID)
+
+			if _, err := compressor.Write(data); err != nil {
+				logger.Error("Failed to stream compress data", "Error", err)
+				return nil, err
+			}
+
+			if err := compressor.Flush(); err != nil {
+				logger.Error("Failed to flush stream compressor", "Error", err)
+				return nil, err
+			}
+
+			compressed := bytes.Clone(bytes.TrimSuffix(buffer.Bytes(), flateSyncMarker))
+
+			logger.Debug("Stream compressed", "ByteCount", len(data), "CompressedByteCount", len(compressed))
+			return compressed, nil
+		}
+	}
+}
+
+// Creates the decompression step for a stream. The last 32KB of decompressed data is kept as the dictionary for the next message, which is all the history the compressor can refer back to.
+func flateStreamDecompressor(limits decompressionLimits) func() func([]byte) ([]byte, error) {
+	return func() func([]byte) ([]byte, error) {
+		var mu sync.Mutex
+		var window []byte
+		decompressor := flate.NewReader(bytes.NewReader(nil))
+
+		return func(data []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(data) == 0 || data[0] != flateStreamID {
+				logger.Error("Failed to stream decompress data. The data was not stream compressed", "Error", ErrCompressionMismatch)
+				return nil, fmt.Errorf("%w: expected stream compression", ErrCompressionMismatch)
+			}
+
+			src := io.MultiReader(bytes.NewReader(data[1:]), bytes.NewReader(flateSyncMarker), bytes.NewReader(flateFinalBlock))
+			if err := decompressor.(flate.Resetter).Reset(src, window); err != nil {
+				logger.Error("Failed to reset stream decompressor", "Error", err)
+				return nil, err
+			}
+
+			decompressed, err := readDecompressed(decompressor, len(data)-1, limits)
+			if err != nil {
+				return nil, err
+			}
+
+			window = append(window, decompressed...)
+			if len(window) > flateWindowSize {
+				window = append(window[:0], window[len(window)-flateWindowSize:]...)
+			}
+
+			logger.Debug("Stream decompressed", "ByteCount", len(decompressed))
+			return decompressed, nil
+		}
+	}
+}
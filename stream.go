@@ -0,0 +1,177 @@
+package onthewire
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Holds state that lives for as long as a built pipeline keeps being used with the same stream, such as a connection. State is created on first use of a stream and is keyed by the io.Reader or io.Writer itself.
+type streamScope[S any] struct {
+	mu       sync.Mutex
+	newState func() S
+	states   map[any]S
+}
+
+func newStreamScope[S any](newState func() S) *streamScope[S] {
+	return &streamScope[S]{
+		newState: newState,
+		states:   make(map[any]S),
+	}
+}
+
+// Returns the state for stream, creating it if this is the first time the stream has been seen.
+func (s *streamScope[S]) get(stream any) S {
+	if stream == nil || !reflect.TypeOf(stream).Comparable() {
+		logger.Warn("Stream cannot be used as a key, state will not be kept between messages", "Type", reflect.TypeOf(stream))
+		return s.newState()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[stream]
+	if !ok {
+		logger.Debug("Creating state for new stream", "Type", reflect.TypeOf(stream))
+		state = s.newState()
+		s.states[stream] = state
+	}
+
+	return state
+}
+
+// Discards the state for stream, so the next use of it starts afresh. This is done when the stream itself fails, as it does when a connection is broken, since the state on either end can no longer be kept in step.
+func (s *streamScope[S]) release(stream any) {
+	if stream == nil || !reflect.TypeOf(stream).Comparable() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.states[stream]; ok {
+		logger.Debug("Releasing state for stream", "Type", reflect.TypeOf(stream))
+		delete(s.states, stream)
+	}
+}
+
+// Marks a failure that leaves the state kept for a stream unusable, such as the frame not being read or written, or a stream decoder or decompressor failing part way through a message.
+//
+// Other failures, such as a decoded value being rejected by a validator, leave the stream in step and keep its state, since the other end keeps its own.
+type streamStateError struct {
+	err error
+}
+
+func (e streamStateError) Error() string {
+	return e.err.Error()
+}
+
+func (e streamStateError) Unwrap() error {
+	return e.err
+}
+
+// Wraps newDecoder so that failures of the decoders it creates are marked as leaving the stream state unusable.
+func streamStateDecoder[R any](newDecoder func() func([]byte) (R, error)) func() func([]byte) (R, error) {
+	return func() func([]byte) (R, error) {
+		decoder := newDecoder()
+		return func(data []byte) (R, error) {
+			t, err := decoder(data)
+			if err != nil {
+				return t, streamStateError{err: err}
+			}
+			return t, nil
+		}
+	}
+}
+
+// Wraps newEncoder so that failures of the encoders it creates are marked as leaving the stream state unusable.
+func streamStateEncoder[W any](newEncoder func() func(W) ([]byte, error)) func() func(W) ([]byte, error) {
+	return func() func(W) ([]byte, error) {
+		encoder := newEncoder()
+		return func(t W) ([]byte, error) {
+			data, err := encoder(t)
+			if err != nil {
+				return nil, streamStateError{err: err}
+			}
+			return data, nil
+		}
+	}
+}
+
+// A step in a read or write pipeline. Either apply is used for every message, or newStream creates the step for each stream on first use so it can keep state, such as a compression context, between the messages on that stream. The code identifies the step in frame headers.
+type pipelineOperation struct {
+	code      operationCode
+	apply     func([]byte) ([]byte, error)
+	newStream func() func([]byte) ([]byte, error)
+}
+
+// Resolves pipeline operations for each stream, keeping a stream scope for every operation that has per-stream state.
+type operationScopes struct {
+	operations []pipelineOperation
+	scopes     []*streamScope[func([]byte) ([]byte, error)]
+	stateful   bool
+}
+
+func newOperationScopes(operations []pipelineOperation) *operationScopes {
+	o := &operationScopes{
+		operations: operations,
+		scopes:     make([]*streamScope[func([]byte) ([]byte, error)], len(operations)),
+	}
+
+	for i, operation := range operations {
+		if operation.newStream != nil {
+			o.scopes[i] = newStreamScope(operation.newStream)
+			o.stateful = true
+		}
+	}
+
+	return o
+}
+
+// Returns the operations to apply to a message on stream, in order.
+func (o *operationScopes) get(stream any) []func([]byte) ([]byte, error) {
+	operations := make([]func([]byte) ([]byte, error), len(o.operations))
+	for i, operation := range o.operations {
+		if o.scopes[i] != nil {
+			operations[i] = o.scopes[i].get(stream)
+		} else {
+			operations[i] = operation.apply
+		}
+	}
+	return operations
+}
+
+// Reports whether the operation at index i keeps state for each stream.
+func (o *operationScopes) hasState(i int) bool {
+	return o.scopes[i] != nil
+}
+
+// Discards the state of every operation for stream.
+func (o *operationScopes) release(stream any) {
+	for _, scope := range o.scopes {
+		if scope != nil {
+			scope.release(stream)
+		}
+	}
+}
+
+// Tracks the stream state of every function built from a pipeline, so the state for a stream can be discarded once the caller is finished with it.
+type streamReleasers struct {
+	mu       sync.Mutex
+	releases []func(any)
+}
+
+func (s *streamReleasers) add(release func(any)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releases = append(s.releases, release)
+}
+
+func (s *streamReleasers) release(stream any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, release := range s.releases {
+		release(stream)
+	}
+}
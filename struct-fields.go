@@ -0,0 +1,189 @@
+package onthewire
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Describes an exported struct field as seen by the reflection based codecs, after applying struct tags.
+type structField struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+type structFieldsKey struct {
+	typ    reflect.Type
+	tagKey string
+}
+
+var structFieldsCache sync.Map
+
+// Returns the exported fields of the struct type t, honouring `tagKey:"name,omitempty"` style tags. Fields tagged with "-" are skipped and untagged embedded structs, or pointers to them, have their fields promoted.
+//
+// Names are resolved as encoding/json does: the shallowest field with a name wins, and of fields at the same depth a tagged one wins. Fields that still clash are dropped.
+func structFields(t reflect.Type, tagKey string) []structField {
+	key := structFieldsKey{typ: t, tagKey: tagKey}
+	if cached, ok := structFieldsCache.Load(key); ok {
+		return cached.([]structField)
+	}
+
+	fields := collectStructFields(t, tagKey)
+	structFieldsCache.Store(key, fields)
+	return fields
+}
+
+// A struct whose fields are being collected, reached through the embedded fields at index.
+type embeddedStruct struct {
+	typ   reflect.Type
+	index []int
+}
+
+type fieldCandidate struct {
+	field  structField
+	tagged bool
+}
+
+func collectStructFields(t reflect.Type, tagKey string) []structField {
+	candidates := make(map[string][]fieldCandidate)
+	names := make([]string, 0, t.NumField())
+
+	// Embedded structs are walked a depth at a time, so shallower fields are found first
+	visited := make(map[reflect.Type]bool)
+	level := []embeddedStruct{{typ: t}}
+	for len(level) > 0 {
+		var next []embeddedStruct
+		for _, s := range level {
+			visited[s.typ] = true
+		}
+
+		for _, s := range level {
+			for i := 0; i < s.typ.NumField(); i++ {
+				f := s.typ.Field(i)
+				index := append(slices.Clone(s.index), i)
+
+				tag := f.Tag.Get(tagKey)
+				if tag == "-" {
+					continue
+				}
+
+				name, opts, _ := strings.Cut(tag, ",")
+
+				if f.Anonymous && name == "" {
+					embedded := f.Type
+					if embedded.Kind() == reflect.Pointer {
+						// Pointers to unexported types can't be allocated when decoding
+						if !f.IsExported() {
+							continue
+						}
+						embedded = embedded.Elem()
+					}
+
+					if embedded.Kind() == reflect.Struct {
+						if !visited[embedded] {
+							next = append(next, embeddedStruct{typ: embedded, index: index})
+						}
+						continue
+					}
+				}
+
+				if !f.IsExported() {
+					continue
+				}
+
+				tagged := name != ""
+				if !tagged {
+					name = f.Name
+				}
+
+				if _, ok := candidates[name]; !ok {
+					names = append(names, name)
+				}
+				candidates[name] = append(candidates[name], fieldCandidate{
+					field: structField{
+						name:      name,
+						index:     index,
+						typ:       f.Type,
+						omitEmpty: hasTagOption(opts, "omitempty"),
+					},
+					tagged: tagged,
+				})
+			}
+		}
+
+		level = next
+	}
+
+	fields := make([]structField, 0, len(names))
+	for _, name := range names {
+		if field, ok := dominantField(candidates[name]); ok {
+			fields = append(fields, field)
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b structField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	return fields
+}
+
+// Picks the field that a name refers to from the fields sharing it, which are in order of depth. There is none if the shallowest fields are equally tagged.
+func dominantField(candidates []fieldCandidate) (structField, bool) {
+	depth := len(candidates[0].field.index)
+
+	var dominant []fieldCandidate
+	for _, c := range candidates {
+		if len(c.field.index) > depth {
+			break
+		}
+		dominant = append(dominant, c)
+	}
+
+	if len(dominant) == 1 {
+		return dominant[0].field, true
+	}
+
+	var tagged []fieldCandidate
+	for _, c := range dominant {
+		if c.tagged {
+			tagged = append(tagged, c)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0].field, true
+	}
+
+	return structField{}, false
+}
+
+func hasTagOption(opts string, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	case reflect.Struct:
+		return v.IsZero()
+	default:
+		return v.IsZero()
+	}
+}
+
+// Reports whether the struct field carries option in its `otw:"..."` tag, a comma separated list of library specific options.
+func hasOTWOption(f reflect.StructField, option string) bool {
+	return hasTagOption(f.Tag.Get("otw"), option)
+}
@@ -0,0 +1,78 @@
+package onthewire
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+var ErrCiphertextTooShort = fmt.Errorf("ciphertext is too short")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypts data with AES-GCM, prefixing the random nonce to the sealed data.
+func symmetricEncrypt(key []byte) func([]byte) ([]byte, error) {
+	seal := symmetricSeal(key)
+	return func(data []byte) ([]byte, error) {
+		return seal(data, nil)
+	}
+}
+
+// Decrypts data produced by symmetricEncrypt.
+func symmetricDecrypt(key []byte) func([]byte) ([]byte, error) {
+	open := symmetricOpen(key)
+	return func(data []byte) ([]byte, error) {
+		return open(data, nil)
+	}
+}
+
+// Encrypts data with AES-GCM like symmetricEncrypt, also authenticating additionalData so the sealed data can only be opened with the same additional data.
+func symmetricSeal(key []byte) func([]byte, []byte) ([]byte, error) {
+	return func(data []byte, additionalData []byte) ([]byte, error) {
+		gcm, err := newGCM(key)
+		if err != nil {
+			logger.Error("Failed to create AES-GCM cipher", "Error", err)
+			return nil, err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			logger.Error("Failed to generate nonce for AES-GCM", "Error", err)
+			return nil, err
+		}
+
+		return gcm.Seal(nonce, nonce, data, additionalData), nil
+	}
+}
+
+// Decrypts data produced by symmetricSeal with the same additional data.
+func symmetricOpen(key []byte) func([]byte, []byte) ([]byte, error) {
+	return func(data []byte, additionalData []byte) ([]byte, error) {
+		gcm, err := newGCM(key)
+		if err != nil {
+			logger.Error("Failed to create AES-GCM cipher", "Error", err)
+			return nil, err
+		}
+
+		if len(data) < gcm.NonceSize() {
+			logger.Error("Failed to decrypt using AES-GCM", "Error", ErrCiphertextTooShort)
+			return nil, ErrCiphertextTooShort
+		}
+
+		nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+		decrypted, err := gcm.Open(nil, nonce, sealed, additionalData)
+		if err != nil {
+			logger.Error("Failed to decrypt using AES-GCM", "Error", err)
+			return nil, err
+		}
+
+		return decrypted, nil
+	}
+}
@@ -0,0 +1,110 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveCompressionRoundTrip(t *testing.T) {
+	payloads := map[string][]byte{
+		"Empty":          {},
+		"Small":          []byte("hi"),
+		"Compressible":   []byte(strings.Repeat("on the wire ", 500)),
+		"Incompressible": make([]byte, 4096),
+	}
+	rand.Read(payloads["Incompressible"])
+
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[[]byte]().UseAdaptiveCompression(64).Build()
+
+			err := write(payload, buffer)
+			assert.Nil(t, err)
+
+			b, err := read(buffer)
+			assert.Nil(t, err)
+
+			assert.True(t, bytes.Equal(payload, b))
+		})
+	}
+}
+
+func TestAdaptiveCompressionStoresWhenNotWorthwhile(t *testing.T) {
+	incompressible := make([]byte, 4096)
+	rand.Read(incompressible)
+
+	cases := []struct {
+		name       string
+		payload    []byte
+		compressed bool
+	}{
+		{"BelowMinSize", []byte(strings.Repeat("a", 63)), false},
+		{"Incompressible", incompressible, false},
+		{"Compressible", []byte(strings.Repeat("a", 1024)), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var captured []byte
+			_, write := otw.New[[]byte]().
+				UseAdaptiveCompression(64).
+				UseCustomOperation(passthrough, captureBytes(&captured)).
+				Build()
+
+			err := write(c.payload, bytes.NewBuffer(nil))
+			assert.Nil(t, err)
+
+			if c.compressed {
+				assert.Equal(t, byte(1), captured[1])
+				assert.Less(t, len(captured), len(c.payload))
+			} else {
+				assert.Equal(t, byte(0), captured[1])
+				assert.Equal(t, c.payload, captured[2:])
+			}
+		})
+	}
+}
+
+func TestAdaptiveCompressorWrapsAnyCompressor(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	c := otw.AdaptiveCompressor(otw.GzipCompressor(flate.BestSpeed), 0)
+	assert.Equal(t, byte(0x82), c.ID())
+
+	read, write := otw.New[TestStruct]().UseCompressionWith(c).Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	s, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, s)
+}
+
+func TestAdaptiveCompressionRejectsInvalidFlag(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[[]byte]().
+		UseAdaptiveCompression(64).
+		UseCustomOperation(func(b []byte) ([]byte, error) {
+			b[1] = 7
+			return b, nil
+		}).
+		Build()
+	read := otw.NewReadPipeline[[]byte]().UseAdaptiveCompression(64).Build()
+
+	err := write([]byte("hi"), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrCompressionFlag)
+}
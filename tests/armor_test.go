@@ -0,0 +1,141 @@
+package onthewire_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+	"unicode"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var armorFormats = map[string]otw.ArmorFormat{
+	"Base64": otw.ArmorBase64,
+	"Base32": otw.ArmorBase32,
+	"Hex":    otw.ArmorHex,
+	"PEM":    otw.ArmorPEM,
+}
+
+func isPrintableText(s string) bool {
+	for _, r := range s {
+		if r != '\n' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestArmoredPipelineRoundTrip(t *testing.T) {
+	for name, format := range armorFormats {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[TestStruct]().UseCompression().UseArmor(format).Build()
+
+			err := write(someStruct, buffer)
+			assert.Nil(t, err)
+
+			err = write(someStruct, buffer)
+			assert.Nil(t, err)
+
+			assert.True(t, isPrintableText(buffer.String()))
+			for _, line := range strings.Split(buffer.String(), "\n") {
+				assert.LessOrEqual(t, len(line), 64)
+			}
+
+			for range 2 {
+				s, err := read(buffer)
+				assert.Nil(t, err)
+				assert.Equal(t, someStruct, s)
+			}
+		})
+	}
+}
+
+func TestArmorWrapsLongMessages(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	payload := make([]byte, 5000)
+	rand.Read(payload)
+
+	read, write := otw.New[[]byte]().UseArmor(otw.ArmorPEM).Build()
+
+	err := write(payload, buffer)
+	assert.Nil(t, err)
+
+	assert.True(t, strings.HasPrefix(buffer.String(), "-----BEGIN OTW MESSAGE-----\n"))
+	assert.True(t, strings.HasSuffix(buffer.String(), "\n-----END OTW MESSAGE-----\n"))
+
+	b, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestArmorToleratesWhitespace(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[string]().UseArmor(otw.ArmorPEM).Build()
+
+	err := write(strings.Repeat("Hello, World! ", 20), buffer)
+	assert.Nil(t, err)
+
+	// Indent every line and use Windows line endings, as an email client might
+	mangled := "\r\n\r\n  " + strings.ReplaceAll(buffer.String(), "\n", " \r\n\t") + "\r\n"
+
+	s, err := read(strings.NewReader(mangled))
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("Hello, World! ", 20), s)
+}
+
+func TestArmorDetectsCorruption(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[string]().UseArmor(otw.ArmorHex).Build()
+
+	err := write("Hello, World!", buffer)
+	assert.Nil(t, err)
+
+	armored := []byte(buffer.String())
+	if armored[0] == 'a' {
+		armored[0] = 'b'
+	} else {
+		armored[0] = 'a'
+	}
+
+	_, err = read(bytes.NewReader(armored))
+	assert.ErrorIs(t, err, otw.ErrArmorChecksum)
+}
+
+func TestArmorRejectsMalformedMessages(t *testing.T) {
+	read := otw.NewReadPipeline[string]().UseArmor(otw.ArmorPEM).Build()
+
+	_, err := read(strings.NewReader("not armor\n"))
+	assert.ErrorIs(t, err, otw.ErrArmorMalformed)
+
+	_, err = read(strings.NewReader("-----BEGIN OTW MESSAGE-----\nSGVsbG8=\n"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestArmorDoesNotReadPastMessage(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	read, write := otw.New[string]().UseArmor(otw.ArmorBase64).Build()
+
+	go func() {
+		write("first", pw)
+		write("second", pw)
+		pw.Close()
+	}()
+
+	s, err := read(pr)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", s)
+
+	s, err = read(bufio.NewReader(pr))
+	assert.Nil(t, err)
+	assert.Equal(t, "second", s)
+}
@@ -0,0 +1,111 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type TelemetryStruct struct {
+	ID        uint16
+	Reading   float32
+	Samples   [3]int16
+	Healthy   bool
+	Sequence  uint64 `otw:"varint"`
+	Delta     int    `otw:"varint"`
+	Timestamp int64
+}
+
+var someTelemetry = TelemetryStruct{
+	ID:        7,
+	Reading:   21.5,
+	Samples:   [3]int16{-1, 0, 1},
+	Healthy:   true,
+	Sequence:  300,
+	Delta:     -2,
+	Timestamp: 1700000000,
+}
+
+func TestBinaryEncodedPipelineForInt64(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someNumber := rand.Int63()
+
+	read, write := otw.New[int64]().UseBinaryEncoding(binary.BigEndian).Build()
+
+	err := write(someNumber, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someNumber, i)
+}
+
+func TestBinaryEncodedPipelineForFloat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someFloat := rand.Float32()
+
+	read, write := otw.New[float32]().UseBinaryEncoding(binary.LittleEndian).Build()
+
+	err := write(someFloat, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someFloat, i)
+}
+
+func TestBinaryEncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TelemetryStruct]().UseBinaryEncoding(binary.LittleEndian).Build()
+
+	err := write(someTelemetry, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someTelemetry, i)
+}
+
+func TestBinaryEncodingWireFormat(t *testing.T) {
+	type Point struct {
+		X uint16
+		Y int32 `otw:"varint"`
+	}
+
+	buffer := bytes.NewBuffer(nil)
+
+	var captured []byte
+	_, write := otw.New[Point]().
+		UseBinaryEncoding(binary.BigEndian).
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(Point{X: 0x0102, Y: -3}, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{0x01, 0x02, 0x05}, captured)
+}
+
+func TestBinaryEncodingFailsAtBuildForVariableSizeType(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[TestStruct]().UseBinaryEncoding(binary.BigEndian).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.New[[]int32]().UseBinaryEncoding(binary.BigEndian).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.NewWritePipeline[int]().UseBinaryEncoding(binary.BigEndian).Build()
+	})
+}
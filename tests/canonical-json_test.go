@@ -0,0 +1,86 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalJSONEncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseCanonicalJSONEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, i)
+}
+
+func TestCanonicalJSONEncodingWireFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"SortedKeys", map[string]any{"b": 1, "a": 2, "aa": 3}, `{"a":2,"aa":3,"b":1}`},
+		{"StructFieldsSorted", TestStruct{I: 1, S: "x"}, `{"B":false,"F":0,"I":1,"S":"x"}`},
+		{"UTF16KeyOrder", map[string]int{"\ufb33": 1, "\U0001F600": 2, "\r": 3}, "{\"\\r\":3,\"\U0001F600\":2,\"\ufb33\":1}"},
+		{"NoHTMLEscaping", "<a & b>", `"<a & b>"`},
+		{"ControlCharacters", "\u0001\n\"\\", `"\u0001\n\"\\"`},
+		{"WholeFloat", 100.0, `100`},
+		{"NegativeZero", -0.0, `0`},
+		{"LargeExponent", 1e21, `1e+21`},
+		{"SmallExponent", 1e-7, `1e-7`},
+		{"NegativeSmallExponent", -1e-7, `-1e-7`},
+		{"NegativeLargeExponent", -1.5e300, `-1.5e+300`},
+		{"LargeFloat", float64(1e20), `100000000000000000000`},
+		{"LargeFloatFraction", 1.2345678901234567e20, `123456789012345670000`},
+		{"Fraction", 0.000001, `0.000001`},
+		{"Nested", []any{map[string]any{"z": nil, "y": true}}, `[{"y":true,"z":null}]`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			var captured []byte
+			_, write := otw.New[any]().
+				UseCanonicalJSONEncoding().
+				UseCustomOperation(passthrough, captureBytes(&captured)).
+				Build()
+
+			err := write(c.value, buffer)
+			assert.Nil(t, err)
+
+			assert.Equal(t, c.expected, string(captured))
+		})
+	}
+}
+
+func TestCanonicalJSONEncodingRejectsImpreciseIntegers(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	_, write := otw.New[int64]().UseCanonicalJSONEncoding().Build()
+
+	err := write(1<<53+1, buffer)
+	assert.NotNil(t, err)
+}
+
+func TestCanonicalJSONEncodingAcceptsLargeFloats(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[float64]().UseCanonicalJSONEncoding().Build()
+
+	err := write(1e20, buffer)
+	assert.Nil(t, err)
+
+	f, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, 1e20, f)
+}
@@ -0,0 +1,205 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCBOREncodedPipelineForInt(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someNumber := rand.Int()
+
+	read, write := otw.New[int]().UseCBOREncoding().Build()
+
+	err := write(someNumber, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someNumber, i)
+}
+
+func TestCBOREncodedPipelineForFloat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someFloat := rand.Float32()
+
+	read, write := otw.New[float32]().UseCBOREncoding().Build()
+
+	err := write(someFloat, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someFloat, i)
+}
+
+func TestCBOREncodedPipelineForString(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someStr := randomString()
+
+	read, write := otw.New[string]().UseCBOREncoding().Build()
+
+	err := write(someStr, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStr, i)
+}
+
+func TestCBOREncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseCBOREncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, i)
+}
+
+func TestCBOREncodedPipelineForTaggedStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TaggedStruct]().UseCBOREncoding().Build()
+
+	err := write(someTaggedStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.True(t, someTaggedStruct.When.Equal(i.When))
+	i.When = someTaggedStruct.When
+	assert.Equal(t, someTaggedStruct, i)
+}
+
+func TestCBOREncodingWireFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    any
+		expected []byte
+	}{
+		{"SmallInt", 10, []byte{0x0a}},
+		{"NegativeInt", -500, []byte{0x39, 0x01, 0xf3}},
+		{"HalfFloat", 1.5, []byte{0xf9, 0x3e, 0x00}},
+		{"SingleFloat", 100000.0, []byte{0xfa, 0x47, 0xc3, 0x50, 0x00}},
+		{"DoubleFloat", 1.1, []byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{"NaN", math.NaN(), []byte{0xf9, 0x7e, 0x00}},
+		{"EpochTime", time.Unix(1363896240, 0), []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}},
+		{"CanonicalKeyOrder", map[string]int{"aa": 1, "b": 2, "a": 3}, []byte{0xa3, 0x61, 'a', 0x03, 0x61, 'b', 0x02, 0x62, 'a', 'a', 0x01}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			var captured []byte
+			_, write := otw.New[any]().
+				UseCBOREncoding().
+				UseCustomOperation(passthrough, captureBytes(&captured)).
+				Build()
+
+			err := write(c.value, buffer)
+			assert.Nil(t, err)
+
+			assert.Equal(t, c.expected, captured)
+		})
+	}
+}
+
+func TestCBOREncodingIsDeterministic(t *testing.T) {
+	var first []byte
+	for range 20 {
+		buffer := bytes.NewBuffer(nil)
+
+		var captured []byte
+		_, write := otw.New[TaggedStruct]().
+			UseCBOREncoding().
+			UseCustomOperation(passthrough, captureBytes(&captured)).
+			Build()
+
+		err := write(someTaggedStruct, buffer)
+		assert.Nil(t, err)
+
+		if first == nil {
+			first = captured
+		}
+		assert.Equal(t, first, captured)
+	}
+}
+
+func TestCBORDecodingRejectsDeeplyNestedArrays(t *testing.T) {
+	// Each 0x81 starts an array holding the next one, and each 0xc6 tags the next value, deep enough to exhaust the stack without a limit
+	nestedArrays := append(bytes.Repeat([]byte{0x81}, 1_000_000), 0xf6)
+	nestedTags := append(bytes.Repeat([]byte{0xc6}, 1_000_000), 0xf6)
+
+	t.Run("Any", func(t *testing.T) {
+		for _, nested := range [][]byte{nestedArrays, nestedTags} {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[any]().
+				UseCBOREncoding().
+				UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return nested, nil }).
+				Build()
+
+			err := write(nil, buffer)
+			assert.Nil(t, err)
+
+			_, err = read(buffer)
+			assert.ErrorContains(t, err, "max nesting depth")
+		}
+	})
+
+	t.Run("RecursiveType", func(t *testing.T) {
+		type Tree []Tree
+
+		buffer := bytes.NewBuffer(nil)
+
+		read, write := otw.New[Tree]().
+			UseCBOREncoding().
+			UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return nestedArrays, nil }).
+			Build()
+
+		err := write(nil, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.ErrorContains(t, err, "max nesting depth")
+	})
+}
+
+func TestCBORDecodingRejectsUnhashableMapKeys(t *testing.T) {
+	// A map holding one entry whose key is the array [1] and whose value is 2
+	payload := []byte{0xa1, 0x81, 0x01, 0x02}
+
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[map[any]int]().
+		UseCBOREncoding().
+		UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return payload, nil }).
+		Build()
+
+	err := write(nil, buffer)
+	assert.Nil(t, err)
+
+	assert.NotPanics(t, func() {
+		_, err = read(buffer)
+	})
+	assert.ErrorContains(t, err, "unsupported map key")
+}
@@ -0,0 +1,94 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var compressors = map[string]otw.Compressor{
+	"Zlib":        otw.ZlibCompressor(flate.DefaultCompression),
+	"ZlibFastest": otw.ZlibCompressor(flate.BestSpeed),
+	"Gzip":        otw.GzipCompressor(flate.BestCompression),
+	"Flate":       otw.FlateCompressor(flate.DefaultCompression),
+	"LZW":         otw.LZWCompressor(),
+}
+
+func TestCompressionWithPipelineForStruct(t *testing.T) {
+	for name, c := range compressors {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[TestStruct]().UseCompressionWith(c).Build()
+
+			err := write(someStruct, buffer)
+			assert.Nil(t, err)
+
+			s, err := read(buffer)
+			assert.Nil(t, err)
+
+			assert.Equal(t, someStruct, s)
+		})
+	}
+}
+
+func TestCompressionWithReducesRepetitivePayloads(t *testing.T) {
+	payload := strings.Repeat("on the wire ", 1000)
+
+	for name, c := range compressors {
+		t.Run(name, func(t *testing.T) {
+			var captured []byte
+			_, write := otw.New[string]().
+				UseCompressionWith(c).
+				UseCustomOperation(passthrough, captureBytes(&captured)).
+				Build()
+
+			err := write(payload, bytes.NewBuffer(nil))
+			assert.Nil(t, err)
+
+			assert.Equal(t, c.ID(), captured[0])
+			assert.Less(t, len(captured), len(payload)/10)
+		})
+	}
+}
+
+func TestCompressionWithDetectsMismatch(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseCompressionWith(otw.GzipCompressor(flate.DefaultCompression)).Build()
+	read := otw.NewReadPipeline[TestStruct]().UseCompressionWith(otw.LZWCompressor()).Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrCompressionMismatch)
+}
+
+func TestCompressionWithZlibIsDistinctFromUseCompression(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseCompressionWith(otw.ZlibCompressor(zlib.DefaultCompression)).Build()
+	read := otw.NewReadPipeline[TestStruct]().UseCompression().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.NotNil(t, err)
+}
+
+func TestCompressionWithFailsAtBuildForInvalidLevel(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[TestStruct]().UseCompressionWith(otw.GzipCompressor(42)).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.NewReadPipeline[TestStruct]().UseCompressionWith(otw.FlateCompressor(-7)).Build()
+	})
+}
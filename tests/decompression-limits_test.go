@@ -0,0 +1,120 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressionRejectsPayloadsOverMaxSize(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	// 10MB of zeros compresses to around 10KB
+	bomb := make([]byte, 10*1024*1024)
+
+	write := otw.NewWritePipeline[[]byte]().UseCompression().Build()
+	read := otw.NewReadPipeline[[]byte]().UseCompression(otw.MaxDecompressedSize(1024 * 1024)).Build()
+
+	err := write(bomb, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrDecompressedTooLarge)
+}
+
+func TestDecompressionAllowsPayloadsAtMaxSize(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	payload := make([]byte, 4096)
+
+	read, write := otw.New[[]byte]().UseCompression(otw.MaxDecompressedSize(4096)).Build()
+
+	err := write(payload, buffer)
+	assert.Nil(t, err)
+
+	b, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestDecompressionRejectsPayloadsOverMaxRatio(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	cases := []struct {
+		name    string
+		payload []byte
+		allowed bool
+	}{
+		{"Zeros", make([]byte, 1024*1024), false},
+		{"Random", random, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[[]byte]().UseCompression(otw.MaxCompressionRatio(100)).Build()
+
+			err := write(c.payload, buffer)
+			assert.Nil(t, err)
+
+			b, err := read(buffer)
+			if c.allowed {
+				assert.Nil(t, err)
+				assert.Equal(t, c.payload, b)
+			} else {
+				assert.ErrorIs(t, err, otw.ErrDecompressedTooLarge)
+			}
+		})
+	}
+}
+
+func TestDecompressionLimitsApplyToAnyCompressor(t *testing.T) {
+	for name, c := range map[string]otw.Compressor{
+		"Gzip":     otw.GzipCompressor(flate.BestCompression),
+		"LZW":      otw.LZWCompressor(),
+		"LZ4":      otw.LZ4Compressor(),
+		"Adaptive": otw.AdaptiveCompressor(otw.FlateCompressor(flate.BestSpeed), 64),
+	} {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			write := otw.NewWritePipeline[[]byte]().UseCompressionWith(c).Build()
+			read := otw.NewReadPipeline[[]byte]().UseCompressionWith(c, otw.MaxDecompressedSize(1024)).Build()
+
+			err := write(make([]byte, 1025), buffer)
+			assert.Nil(t, err)
+
+			_, err = read(buffer)
+			assert.ErrorIs(t, err, otw.ErrDecompressedTooLarge)
+		})
+	}
+}
+
+func TestLZ4DecompressionLimitIsCheckedBeforeDecompressing(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	// Claims to decompress to 2550 bytes, but the block is garbage that would fail to decompress
+	block := append([]byte{6, 0xf6, 0x13}, bytes.Repeat([]byte{0xff}, 10)...)
+
+	write := otw.NewWritePipeline[[]byte]().Build()
+	read := otw.NewReadPipeline[[]byte]().UseLZ4Compression().Build()
+	limitedRead := otw.NewReadPipeline[[]byte]().UseCompressionWith(otw.LZ4Compressor(), otw.MaxDecompressedSize(1024)).Build()
+
+	err := write(block, buffer)
+	assert.Nil(t, err)
+
+	err = write(block, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrLZ4Corrupt)
+
+	_, err = limitedRead(buffer)
+	assert.ErrorIs(t, err, otw.ErrDecompressedTooLarge)
+}
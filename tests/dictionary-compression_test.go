@@ -0,0 +1,192 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type AuditEvent struct {
+	UserID int    `json:"user_id"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+func auditEvents(n int) []AuditEvent {
+	actions := []string{"login", "logout", "view", "purchase"}
+
+	events := make([]AuditEvent, 0, n)
+	for i := range n {
+		events = append(events, AuditEvent{
+			UserID: i * 37,
+			Action: actions[i%len(actions)],
+			Path:   fmt.Sprintf("/api/v1/items/%d", i*13),
+			Status: 200 + i%3,
+		})
+	}
+	return events
+}
+
+func trainAuditDictionary(t *testing.T) []byte {
+	dict, err := otw.TrainDictionary(auditEvents(200), func(e AuditEvent) ([]byte, error) {
+		return json.Marshal(e)
+	}, 4096)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, dict)
+	assert.LessOrEqual(t, len(dict), 4096)
+	return dict
+}
+
+func TestDictionaryCompressionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	dict := trainAuditDictionary(t)
+
+	read, write := otw.New[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(dict).Build()
+
+	event := AuditEvent{UserID: 9999, Action: "view", Path: "/api/v1/items/777", Status: 200}
+
+	err := write(event, buffer)
+	assert.Nil(t, err)
+
+	e, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, event, e)
+}
+
+func TestDictionaryCompressionBeatsPlainZlibOnSmallMessages(t *testing.T) {
+	dict := trainAuditDictionary(t)
+	event := AuditEvent{UserID: 9999, Action: "view", Path: "/api/v1/items/777", Status: 200}
+
+	compressedLen := func(c otw.Compressor) int {
+		var captured []byte
+		_, write := otw.New[AuditEvent]().
+			UseJSONEncoding().
+			UseCompressionWith(c).
+			UseCustomOperation(passthrough, captureBytes(&captured)).
+			Build()
+
+		err := write(event, bytes.NewBuffer(nil))
+		assert.Nil(t, err)
+		return len(captured)
+	}
+
+	plain := compressedLen(otw.ZlibCompressor(flate.BestCompression))
+	withDict := compressedLen(otw.DictionaryCompressor(flate.BestCompression, dict))
+
+	assert.Less(t, withDict, plain/2)
+}
+
+func TestDictionaryCompressionWritesDictionaryID(t *testing.T) {
+	dict := trainAuditDictionary(t)
+
+	var captured []byte
+	_, write := otw.New[AuditEvent]().
+		UseJSONEncoding().
+		UseDictionaryCompression(dict).
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(AuditEvent{Action: "login"}, bytes.NewBuffer(nil))
+	assert.Nil(t, err)
+
+	// The zlib header follows the compressor ID directly, with its FDICT flag set and the dictionary ID after it
+	id := otw.DictionaryID(dict)
+	assert.Equal(t, byte(5), captured[0])
+	assert.Equal(t, byte(0x78), captured[1])
+	assert.NotZero(t, captured[2]&0x20)
+	assert.Equal(t, []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}, captured[3:7])
+}
+
+func TestDictionaryCompressionRejectsUnknownDictionary(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(trainAuditDictionary(t)).Build()
+	read := otw.NewReadPipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression([]byte(`{"user_id":"action":"path":"status":}`)).Build()
+
+	err := write(AuditEvent{Action: "login"}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrUnknownDictionary)
+}
+
+func TestDictionaryCompressionRejectsDataWithoutDictionary(t *testing.T) {
+	plain := bytes.NewBuffer(nil)
+	z := zlib.NewWriter(plain)
+	_, err := z.Write([]byte(`{"action":"login"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, z.Close())
+
+	// The compressor ID for dictionary compression followed by zlib data compressed without one
+	payload := append([]byte{5}, plain.Bytes()...)
+
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[AuditEvent]().
+		UseJSONEncoding().
+		UseCustomOperation(func([]byte) ([]byte, error) { return payload, nil }).
+		Build()
+	read := otw.NewReadPipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(trainAuditDictionary(t)).Build()
+
+	err = write(AuditEvent{Action: "login"}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrUnknownDictionary)
+}
+
+func TestDictionaryCompressionRotation(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	oldDict := []byte(`{"user_id":"action":"path":"status":}`)
+	newDict := trainAuditDictionary(t)
+
+	writeOld := otw.NewWritePipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(oldDict).Build()
+	writeNew := otw.NewWritePipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(newDict, oldDict).Build()
+	read := otw.NewReadPipeline[AuditEvent]().UseJSONEncoding().UseDictionaryCompression(newDict, oldDict).Build()
+
+	events := auditEvents(2)
+
+	err := writeOld(events[0], buffer)
+	assert.Nil(t, err)
+
+	err = writeNew(events[1], buffer)
+	assert.Nil(t, err)
+
+	for _, event := range events {
+		e, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, event, e)
+	}
+}
+
+func TestDictionaryCompressionFailsAtBuildWithoutDictionaries(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[AuditEvent]().UseDictionaryCompression().Build()
+	})
+}
+
+func TestBuildDictionaryIsDeterministicAndBounded(t *testing.T) {
+	samples := make([][]byte, 0)
+	for _, e := range auditEvents(100) {
+		b, err := json.Marshal(e)
+		assert.Nil(t, err)
+		samples = append(samples, b)
+	}
+
+	dict := otw.BuildDictionary(samples, 64)
+	assert.LessOrEqual(t, len(dict), 64)
+	assert.Contains(t, string(dict), `{"user_id":`)
+
+	assert.Equal(t, dict, otw.BuildDictionary(samples, 64))
+	assert.Empty(t, otw.BuildDictionary(nil, 64))
+}
@@ -0,0 +1,253 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Credentials struct {
+	Token  []byte `otw:"encrypt"`
+	Scopes []string
+}
+
+type Customer struct {
+	Name        string
+	SSN         string `otw:"encrypt"`
+	Credentials *Credentials
+}
+
+var someKey = []byte("0123456789abcdef0123456789abcdef")
+
+func someCustomer() Customer {
+	return Customer{
+		Name:        "Ada",
+		SSN:         "123-45-6789",
+		Credentials: &Credentials{Token: []byte("secret-token"), Scopes: []string{"read"}},
+	}
+}
+
+func TestFieldEncryptionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[Customer]().UseFieldEncryption(getKeys()).Build()
+
+	customer := someCustomer()
+	err := write(customer, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someCustomer(), customer)
+
+	c, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, customer, c)
+}
+
+func TestSymmetricFieldEncryptionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	keyFn := func() []byte { return someKey }
+	read, write := otw.New[Customer]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn).Build()
+
+	err := write(someCustomer(), buffer)
+	assert.Nil(t, err)
+
+	c, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someCustomer(), c)
+}
+
+func TestFieldEncryptionLeavesOtherFieldsReadable(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	keyFn := func() []byte { return someKey }
+	write := otw.NewWritePipeline[Customer]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn).Build()
+	read := otw.NewReadPipeline[Customer]().UseJSONEncoding().Build()
+
+	err := write(someCustomer(), buffer)
+	assert.Nil(t, err)
+
+	c, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "Ada", c.Name)
+	assert.Equal(t, []string{"read"}, c.Credentials.Scopes)
+
+	assert.NotEqual(t, someCustomer().SSN, c.SSN)
+	_, err = base64.StdEncoding.DecodeString(c.SSN)
+	assert.Nil(t, err)
+	assert.NotEqual(t, someCustomer().Credentials.Token, c.Credentials.Token)
+}
+
+func TestFieldEncryptionWithoutKeyLeavesFieldsOpaque(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	publicKeyFn, _ := getKeys()
+	write := otw.NewWritePipeline[Customer]().UseFieldEncryption(publicKeyFn).Build()
+	read := otw.NewReadPipeline[Customer]().UseFieldEncryption(func() *rsa.PrivateKey { return nil }).Build()
+
+	err := write(someCustomer(), buffer)
+	assert.Nil(t, err)
+
+	c, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "Ada", c.Name)
+	assert.NotEqual(t, someCustomer().SSN, c.SSN)
+}
+
+func TestFieldEncryptionWriteFailsWithoutKey(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[Customer]().UseSymmetricFieldEncryption(func() []byte { return nil }).Build()
+
+	err := write(someCustomer(), buffer)
+	assert.ErrorIs(t, err, otw.ErrFieldKeyUnavailable)
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func TestFieldEncryptionFailsAtBuildForUnsupportedField(t *testing.T) {
+	type Balance struct {
+		Amount int `otw:"encrypt"`
+	}
+
+	assert.Panics(t, func() {
+		otw.New[Balance]().UseFieldEncryption(getKeys()).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.NewReadPipeline[*Balance]().UseSymmetricFieldEncryption(func() []byte { return someKey }).Build()
+	})
+}
+
+func TestFieldEncryptionTagsAreIgnoredWhenNotEnabled(t *testing.T) {
+	type Balance struct {
+		Amount int `otw:"encrypt"`
+	}
+
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[Balance]().Build()
+
+	err := write(Balance{Amount: 10}, buffer)
+	assert.Nil(t, err)
+
+	b, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, Balance{Amount: 10}, b)
+}
+
+type BankAccount struct {
+	Number string
+	SSN    string `otw:"encrypt"`
+}
+
+type Holder struct {
+	Accounts []BankAccount
+	ByName   map[string]*BankAccount
+	Pair     [2]BankAccount
+	Nested   [][]BankAccount
+}
+
+func someHolder() Holder {
+	return Holder{
+		Accounts: []BankAccount{{Number: "1", SSN: "111-11-1111"}},
+		ByName:   map[string]*BankAccount{"ada": {Number: "2", SSN: "222-22-2222"}},
+		Pair:     [2]BankAccount{{Number: "3", SSN: "333-33-3333"}, {Number: "4", SSN: "444-44-4444"}},
+		Nested:   [][]BankAccount{{{Number: "5", SSN: "555-55-5555"}}},
+	}
+}
+
+func TestFieldEncryptionInSlicesArraysAndMaps(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	keyFn := func() []byte { return someKey }
+	read, write := otw.New[Holder]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn).Build()
+
+	holder := someHolder()
+	err := write(holder, buffer)
+	assert.Nil(t, err)
+
+	// The value written is left untouched
+	assert.Equal(t, someHolder(), holder)
+
+	for _, ssn := range []string{"111-11-1111", "222-22-2222", "333-33-3333", "444-44-4444", "555-55-5555"} {
+		assert.NotContains(t, buffer.String(), ssn)
+	}
+	assert.Contains(t, buffer.String(), `"Number":"2"`)
+
+	h, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, someHolder(), h)
+}
+
+func TestFieldEncryptionInInterfaces(t *testing.T) {
+	type Envelope struct {
+		Payload any
+	}
+
+	buffer := bytes.NewBuffer(nil)
+
+	keyFn := func() []byte { return someKey }
+	write := otw.NewWritePipeline[Envelope]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn).Build()
+
+	err := write(Envelope{Payload: []BankAccount{{Number: "1", SSN: "111-11-1111"}}}, buffer)
+	assert.Nil(t, err)
+
+	assert.NotContains(t, buffer.String(), "111-11-1111")
+	assert.Contains(t, buffer.String(), `"Number":"1"`)
+}
+
+func TestFieldEncryptionFailsAtBuildForEncryptedMapKeys(t *testing.T) {
+	type Index struct {
+		ByAccount map[BankAccount]int
+	}
+
+	assert.Panics(t, func() {
+		otw.NewWritePipeline[Index]().UseSymmetricFieldEncryption(func() []byte { return someKey }).Build()
+	})
+}
+
+func TestSymmetricFieldEncryptionRejectsSwappedFields(t *testing.T) {
+	// Moves the encrypted SSN into the token field, which is also Base64 in JSON
+	swapFields := func(b []byte) ([]byte, error) {
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		m["Credentials"].(map[string]any)["Token"] = m["SSN"]
+		return json.Marshal(m)
+	}
+
+	keyFn := func() []byte { return someKey }
+
+	for name, swap := range map[string]bool{"Untouched": false, "Swapped": true} {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			write := otw.NewWritePipeline[Customer]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn)
+			if swap {
+				write = write.UseCustomOperation(swapFields)
+			}
+			read := otw.NewReadPipeline[Customer]().UseJSONEncoding().UseSymmetricFieldEncryption(keyFn).Build()
+
+			err := write.Build()(someCustomer(), buffer)
+			assert.Nil(t, err)
+
+			c, err := read(buffer)
+			if swap {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, someCustomer(), c)
+		})
+	}
+}
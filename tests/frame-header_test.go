@@ -0,0 +1,209 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameHeaderRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().
+		UseJSONEncoding().
+		UseCompression().
+		UseNonce(func() int { return 42 }, func(i int) bool { return i == 42 }).
+		UseAsymmetricEncryption(getKeys()).
+		UseSigning(getKeys()).
+		UseFrameHeader().
+		Build()
+
+	for range 3 {
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+	}
+
+	for range 3 {
+		s, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, someStruct, s)
+	}
+}
+
+func TestFrameHeaderWireFormat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[string]().UseCompressionWith(otw.LZ4Compressor()).UseFrameHeader().Build()
+
+	err := write("hi", buffer)
+	assert.Nil(t, err)
+
+	// Skip the length of the first chunk
+	header := buffer.Bytes()[4:]
+	assert.Equal(t, []byte("OTW"), header[:3])
+	// Version, raw encoding, no flags and one operation, which is compression with compressor 6
+	assert.Equal(t, []byte{1, 3, 0, 1, 3, 6}, header[3:9])
+}
+
+func TestFrameHeaderWithStreamsAndArmor(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().
+		UseGobStreamEncoding().
+		UseStreamCompression(zlib.BestCompression).
+		UseArmor(otw.ArmorPEM).
+		UseFrameHeader().
+		Build()
+
+	for range 3 {
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+	}
+
+	for range 3 {
+		s, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, someStruct, s)
+	}
+}
+
+func TestFrameHeaderAllowsCompatibleEncodings(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseCanonicalJSONEncoding().UseFrameHeader().Build()
+	read := otw.NewReadPipeline[TestStruct]().UseJSONEncoding().UseFrameHeader().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	s, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, someStruct, s)
+}
+
+func TestFrameHeaderDetectsMismatch(t *testing.T) {
+	type Point struct {
+		X, Y int32
+	}
+
+	publicKeyFn, privateKeyFn := getKeys()
+
+	cases := []struct {
+		name   string
+		write  func(Point, io.Writer) error
+		read   func(io.Reader) (Point, error)
+		reason string
+	}{
+		{
+			"Encoding",
+			otw.NewWritePipeline[Point]().UseJSONEncoding().UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseFrameHeader().Build(),
+			"written with JSON encoding, read with Gob encoding",
+		},
+		{
+			"ByteOrder",
+			otw.NewWritePipeline[Point]().UseBinaryEncoding(binary.LittleEndian).UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseBinaryEncoding(binary.BigEndian).UseFrameHeader().Build(),
+			"written with little endian Binary encoding, read with big endian Binary encoding",
+		},
+		{
+			"OperationOrder",
+			otw.NewWritePipeline[Point]().UseCompression().UseSigning(privateKeyFn).UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseSigning(publicKeyFn).UseCompression().UseFrameHeader().Build(),
+			"written with operations [compression, signing], read with [signing, compression]",
+		},
+		{
+			"MissingOperation",
+			otw.NewWritePipeline[Point]().UseCompression().UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseFrameHeader().Build(),
+			"written with operations [compression], read with []",
+		},
+		{
+			"Compressor",
+			otw.NewWritePipeline[Point]().UseLZ4Compression().UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseCompressionWith(otw.ZlibCompressor(zlib.DefaultCompression)).UseFrameHeader().Build(),
+			"written with operations [compression with compressor 6], read with [compression with compressor 1]",
+		},
+		{
+			"Schema",
+			otw.NewWritePipeline[Point]().UseSchemaVersion(2).UseFrameHeader().Build(),
+			otw.NewReadPipeline[Point]().UseFrameHeader().Build(),
+			"written with schema versions, read without",
+		},
+		{
+			"NoHeader",
+			otw.NewWritePipeline[Point]().Build(),
+			otw.NewReadPipeline[Point]().UseFrameHeader().Build(),
+			"message has no frame header",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			err := c.write(Point{X: 1, Y: 2}, buffer)
+			assert.Nil(t, err)
+
+			_, err = c.read(buffer)
+			assert.ErrorIs(t, err, otw.ErrPipelineMismatch)
+			assert.ErrorContains(t, err, c.reason)
+		})
+	}
+}
+
+func TestFrameHeaderReportsEveryDifference(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseJSONEncoding().UseCompression().UseFrameHeader().Build()
+	read := otw.NewReadPipeline[TestStruct]().UseMsgPackEncoding().UseFrameHeader().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrPipelineMismatch)
+	assert.ErrorContains(t, err, "written with JSON encoding, read with MessagePack encoding; written with operations [compression], read with []")
+}
+
+func TestFrameHeaderIsCheckedBeforeOperations(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[[]byte]().UseCompression().UseFrameHeader().Build()
+
+	called := false
+	read := otw.NewReadPipeline[[]byte]().
+		UseCustomOperation(func(b []byte) ([]byte, error) {
+			called = true
+			return b, nil
+		}).
+		UseFrameHeader().
+		Build()
+
+	err := write([]byte("Hello, World!"), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrPipelineMismatch)
+	assert.False(t, called)
+}
+
+func TestFrameHeaderRejectsUnsupportedVersion(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[[]byte]().Build()
+	read := otw.NewReadPipeline[[]byte]().UseFrameHeader().Build()
+
+	// A header from a future version, which could be laid out differently
+	err := write([]byte("OTW\x02\x03\x00\x00Hello"), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrPipelineMismatch)
+	assert.ErrorContains(t, err, "version 2 is not supported")
+}
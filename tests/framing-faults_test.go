@@ -0,0 +1,203 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+var errInjected = errors.New("injected fault")
+
+// Fails once limit bytes have been written, after writing as much as fits.
+type failingWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) <= f.limit {
+		f.limit -= len(p)
+		return f.w.Write(p)
+	}
+
+	n, _ := f.w.Write(p[:f.limit])
+	f.limit = 0
+	return n, errInjected
+}
+
+// Writes less than asked without reporting an error, breaking the io.Writer contract.
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) {
+	return len(p) / 2, nil
+}
+
+// Splits every write into writes of at most size bytes.
+type splittingWriter struct {
+	w    io.Writer
+	size int
+}
+
+func (s splittingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, err := s.w.Write(p[:min(s.size, len(p))])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func framingPayloads() [][]byte {
+	payloads := [][]byte{{}, []byte("a"), make([]byte, 1023), make([]byte, 1024), make([]byte, 1025), make([]byte, 5000)}
+	for _, payload := range payloads {
+		rand.Read(payload)
+	}
+	return payloads
+}
+
+func TestFramingHandlesPartialReads(t *testing.T) {
+	readers := map[string]func(io.Reader) io.Reader{
+		"OneByte": iotest.OneByteReader,
+		"Half":    iotest.HalfReader,
+		"DataErr": iotest.DataErrReader,
+	}
+
+	for name, wrap := range readers {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[[]byte]().Build()
+
+			payloads := framingPayloads()
+			for _, payload := range payloads {
+				err := write(payload, buffer)
+				assert.Nil(t, err)
+			}
+
+			r := wrap(buffer)
+			for _, payload := range payloads {
+				b, err := read(r)
+				assert.Nil(t, err)
+				assert.True(t, bytes.Equal(payload, b))
+			}
+
+			_, err := read(r)
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+func TestFramingHandlesPartialReadsThroughOperations(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().
+		UseCompression().
+		UseNonce(func() int { return 42 }, func(i int) bool { return i == 42 }).
+		UseAsymmetricEncryption(getKeys()).
+		Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	s, err := read(iotest.OneByteReader(buffer))
+	assert.Nil(t, err)
+	assert.Equal(t, someStruct, s)
+}
+
+func TestFramingOverConnection(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	read, write := otw.New[[]byte]().Build()
+
+	payloads := framingPayloads()
+	go func() {
+		w := splittingWriter{w: client, size: 7}
+		for _, payload := range payloads {
+			if err := write(payload, w); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, payload := range payloads {
+		b, err := read(server)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(payload, b))
+	}
+}
+
+func TestFramingReportsTruncatedMessages(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]byte]().Build()
+
+	err := write(make([]byte, 2000), buffer)
+	assert.Nil(t, err)
+	written := buffer.Bytes()
+
+	_, err = read(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, io.EOF)
+
+	for i := 1; i < len(written); i++ {
+		_, err := read(bytes.NewReader(written[:i]))
+		if !assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "truncated to %d bytes", i) {
+			return
+		}
+	}
+}
+
+func TestFramingPropagatesWriteErrors(t *testing.T) {
+	counting := bytes.NewBuffer(nil)
+
+	_, write := otw.New[[]byte]().Build()
+
+	payload := make([]byte, 2000)
+	err := write(payload, counting)
+	assert.Nil(t, err)
+
+	for limit := 0; limit < counting.Len(); limit++ {
+		err := write(payload, &failingWriter{w: io.Discard, limit: limit})
+		if !assert.ErrorIs(t, err, errInjected, "failing after %d bytes", limit) {
+			return
+		}
+	}
+}
+
+func TestFramingReportsShortWrites(t *testing.T) {
+	_, write := otw.New[string]().Build()
+
+	err := write("Hello, World!", shortWriter{})
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+}
+
+func TestArmorPropagatesWriteErrors(t *testing.T) {
+	_, write := otw.New[string]().UseArmor(otw.ArmorPEM).Build()
+
+	err := write("Hello, World!", &failingWriter{w: io.Discard, limit: 10})
+	assert.ErrorIs(t, err, errInjected)
+}
+
+func TestFramingPropagatesReadErrors(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]byte]().Build()
+
+	err := write(make([]byte, 2000), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(iotest.TimeoutReader(iotest.HalfReader(buffer)))
+	assert.ErrorIs(t, err, iotest.ErrTimeout)
+}
@@ -0,0 +1,182 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// Counts the calls made to Write.
+type countingWriter struct {
+	w     io.Writer
+	calls int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.calls++
+	return c.w.Write(p)
+}
+
+func TestFramingOptionsRoundTrip(t *testing.T) {
+	payloads := [][]byte{{}, make([]byte, 1), make([]byte, 1023), make([]byte, 1024), make([]byte, 1025), make([]byte, 100*1024)}
+	for _, payload := range payloads {
+		rand.Read(payload)
+	}
+
+	for _, chunkSize := range []int{1, 7, 1024, 64 * 1024} {
+		for _, varint := range []bool{false, true} {
+			t.Run(fmt.Sprintf("ChunkSize%dVarint%t", chunkSize, varint), func(t *testing.T) {
+				buffer := bytes.NewBuffer(nil)
+
+				p := otw.New[[]byte]().UseChunkSize(chunkSize)
+				if varint {
+					p.UseVarintLengths()
+				}
+				read, write := p.Build()
+
+				for _, payload := range payloads {
+					err := write(payload, buffer)
+					assert.Nil(t, err)
+				}
+
+				// Read without io.ByteReader, a byte at a time
+				r := iotest.OneByteReader(buffer)
+				for _, payload := range payloads {
+					b, err := read(r)
+					assert.Nil(t, err)
+					assert.True(t, bytes.Equal(payload, b))
+				}
+			})
+		}
+	}
+}
+
+func TestFramingWireFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		pipeline *otw.WritePipeline[string]
+		expected []byte
+	}{
+		{"Default", otw.NewWritePipeline[string](), []byte{0, 0, 0, 2, 'h', 'i', 0, 0, 0, 0}},
+		{"SmallChunks", otw.NewWritePipeline[string]().UseChunkSize(1), []byte{0, 0, 0, 1, 'h', 0, 0, 0, 1, 'i', 0, 0, 0, 0}},
+		{"Varint", otw.NewWritePipeline[string]().UseVarintLengths(), []byte{0xff, 2, 'h', 'i', 0}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			err := c.pipeline.Build()("hi", buffer)
+			assert.Nil(t, err)
+
+			assert.Equal(t, c.expected, buffer.Bytes())
+		})
+	}
+}
+
+func TestFramingWritesEachChunkInOneCall(t *testing.T) {
+	payload := make([]byte, 100*1024)
+
+	cases := map[int]int{
+		1024:       100,
+		64 * 1024:  2,
+		128 * 1024: 1,
+	}
+
+	for chunkSize, calls := range cases {
+		t.Run(fmt.Sprint(chunkSize), func(t *testing.T) {
+			w := &countingWriter{w: io.Discard}
+
+			write := otw.NewWritePipeline[[]byte]().UseChunkSize(chunkSize).Build()
+
+			err := write(payload, w)
+			assert.Nil(t, err)
+
+			assert.Equal(t, calls, w.calls)
+		})
+	}
+}
+
+func TestFramingDetectsMismatch(t *testing.T) {
+	cases := map[string]struct {
+		write func([]byte, io.Writer) error
+		read  func(io.Reader) ([]byte, error)
+	}{
+		"VarintWriterFixedReader": {
+			otw.NewWritePipeline[[]byte]().UseVarintLengths().Build(),
+			otw.NewReadPipeline[[]byte]().Build(),
+		},
+		"FixedWriterVarintReader": {
+			otw.NewWritePipeline[[]byte]().Build(),
+			otw.NewReadPipeline[[]byte]().UseVarintLengths().Build(),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			err := c.write([]byte("Hello, World!"), buffer)
+			assert.Nil(t, err)
+
+			_, err = c.read(buffer)
+			assert.ErrorIs(t, err, otw.ErrFramingMismatch)
+		})
+	}
+}
+
+func TestFramingRejectsImpossibleChunkLengths(t *testing.T) {
+	read := otw.NewReadPipeline[[]byte]().Build()
+	_, err := read(bytes.NewReader(binary.BigEndian.AppendUint32(nil, 0xfffffff0)))
+	assert.ErrorIs(t, err, otw.ErrFramingMismatch)
+
+	read = otw.NewReadPipeline[[]byte]().UseVarintLengths().Build()
+	_, err = read(bytes.NewReader(binary.AppendUvarint([]byte{0xff}, 1<<40)))
+	assert.ErrorIs(t, err, otw.ErrFramingMismatch)
+
+	// With a limit, the length is also too large
+	read = otw.NewReadPipeline[[]byte]().UseMaxMessageSize(1024).Build()
+	_, err = read(bytes.NewReader(binary.BigEndian.AppendUint32(nil, 0xfffffff0)))
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+	assert.ErrorIs(t, err, otw.ErrFramingMismatch)
+
+	read = otw.NewReadPipeline[[]byte]().UseVarintLengths().UseMaxMessageSize(1024).Build()
+	_, err = read(bytes.NewReader(binary.AppendUvarint([]byte{0xff}, 1<<40)))
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+	assert.ErrorIs(t, err, otw.ErrFramingMismatch)
+}
+
+func TestVarintLengthsWithMaxMessageSize(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]byte]().UseVarintLengths().UseChunkSize(4096).UseMaxMessageSize(10000).Build()
+
+	err := write(make([]byte, 10000), buffer)
+	assert.Nil(t, err)
+
+	err = write(make([]byte, 10001), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+}
+
+func TestChunkSizeFailsAtBuildWhenInvalid(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[[]byte]().UseChunkSize(0).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.NewWritePipeline[[]byte]().UseChunkSize(1 << 24).Build()
+	})
+}
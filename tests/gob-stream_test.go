@@ -0,0 +1,232 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGobStreamEncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseGobStreamEncoding().Build()
+
+	for i := range 5 {
+		message := someStruct
+		message.I = i
+
+		err := write(message, buffer)
+		assert.Nil(t, err)
+	}
+
+	for i := range 5 {
+		message, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, i, message.I)
+		assert.Equal(t, someStruct.S, message.S)
+	}
+}
+
+func TestGobStreamEncodingOnlySendsTypeOnce(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	sizes := make([]int, 0)
+	recordSize := func(b []byte) ([]byte, error) {
+		sizes = append(sizes, len(b))
+		return b, nil
+	}
+
+	_, write := otw.New[TestStruct]().
+		UseGobStreamEncoding().
+		UseCustomOperation(passthrough, recordSize).
+		Build()
+
+	for range 3 {
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+	}
+
+	_, gobWrite := otw.New[TestStruct]().
+		UseGobEncoding().
+		UseCustomOperation(passthrough, recordSize).
+		Build()
+
+	err := gobWrite(someStruct, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, sizes[0], sizes[3])
+	assert.Equal(t, sizes[1], sizes[2])
+	assert.Less(t, sizes[1]*2, sizes[0])
+}
+
+func TestGobStreamEncodingIsScopedToStream(t *testing.T) {
+	first := bytes.NewBuffer(nil)
+	second := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseGobStreamEncoding().Build()
+
+	for _, buffer := range []*bytes.Buffer{first, first, second} {
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+	}
+
+	// The second stream received its own type descriptors, so can be read independently
+	i, err := read(second)
+	assert.Nil(t, err)
+	assert.Equal(t, someStruct, i)
+
+	for range 2 {
+		i, err := read(first)
+		assert.Nil(t, err)
+		assert.Equal(t, someStruct, i)
+	}
+}
+
+// A stream that can be broken and then reconnected, as a net.Conn would be when redialled
+type ReconnectableBuffer struct {
+	buffer bytes.Buffer
+	broken bool
+}
+
+func (rb *ReconnectableBuffer) Read(p []byte) (int, error) {
+	if rb.broken {
+		return 0, io.ErrClosedPipe
+	}
+	return rb.buffer.Read(p)
+}
+
+func (rb *ReconnectableBuffer) Write(p []byte) (int, error) {
+	if rb.broken {
+		return 0, io.ErrClosedPipe
+	}
+	return rb.buffer.Write(p)
+}
+
+func TestGobStreamEncodingResetsWhenStreamIsRecreated(t *testing.T) {
+	conn := &ReconnectableBuffer{}
+
+	write := otw.NewWritePipeline[TestStruct]().UseGobStreamEncoding().Build()
+	read := otw.NewReadPipeline[TestStruct]().UseGobStreamEncoding().Build()
+
+	for range 2 {
+		err := write(someStruct, conn)
+		assert.Nil(t, err)
+
+		i, err := read(conn)
+		assert.Nil(t, err)
+		assert.Equal(t, someStruct, i)
+	}
+
+	conn.broken = true
+
+	err := write(someStruct, conn)
+	assert.NotNil(t, err)
+
+	// The peer reconnects with a new read pipeline, so has none of the earlier type descriptors
+	conn.broken = false
+	conn.buffer.Reset()
+	read = otw.NewReadPipeline[TestStruct]().UseGobStreamEncoding().Build()
+
+	err = write(someStruct, conn)
+	assert.Nil(t, err)
+
+	i, err := read(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, someStruct, i)
+}
+
+func TestGobStreamEncodingStartsAfreshWhenReleased(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	sizes := make([]int, 0)
+	recordSize := func(b []byte) ([]byte, error) {
+		sizes = append(sizes, len(b))
+		return b, nil
+	}
+
+	p := otw.New[TestStruct]().UseGobStreamEncoding().UseCustomOperation(passthrough, recordSize)
+	read, write := p.Build()
+
+	for range 2 {
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.Nil(t, err)
+	}
+
+	p.Release(buffer)
+
+	// Type descriptors are sent again, and the reader expects them
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, sizes[0], sizes[2])
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, someStruct, i)
+}
+
+func TestGobStreamEncodingReleaseDropsStream(t *testing.T) {
+	p := otw.New[TestStruct]().UseGobStreamEncoding()
+	_, write := p.Build()
+	// The pipeline remains in use, as it would on a server
+	defer runtime.KeepAlive(write)
+
+	collected := make(chan struct{})
+	func() {
+		buffer := bytes.NewBuffer(nil)
+		runtime.SetFinalizer(buffer, func(*bytes.Buffer) { close(collected) })
+
+		err := write(someStruct, buffer)
+		assert.Nil(t, err)
+
+		p.Release(buffer)
+	}()
+
+	for range 10 {
+		runtime.GC()
+		select {
+		case <-collected:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("stream was still referenced after being released")
+}
+
+func TestGobStreamEncodingKeepsStreamAfterRejectedMessage(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	rejectEven := func(s TestStruct) error {
+		if s.I%2 == 0 {
+			return errors.New("bad")
+		}
+		return nil
+	}
+
+	read, write := otw.New[TestStruct]().UseGobStreamEncoding().UseValidator(rejectEven).Build()
+
+	for i := 1; i <= 4; i++ {
+		s := someStruct
+		s.I = i
+		err := write(s, buffer)
+		assert.Nil(t, err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		s, err := read(buffer)
+		if i%2 == 0 {
+			assert.EqualError(t, err, "bad")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, i, s.I)
+	}
+}
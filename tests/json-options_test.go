@@ -0,0 +1,109 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type NarrowStruct struct {
+	I int
+}
+
+type AnyStruct struct {
+	Value any
+}
+
+func TestJSONDisallowUnknownFields(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseJSONEncoding().Build()
+	read := otw.NewReadPipeline[NarrowStruct]().UseJSONEncoding(otw.JSONDisallowUnknownFields()).Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.NotNil(t, err)
+}
+
+func TestJSONUnknownFieldsIgnoredByDefault(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[TestStruct]().UseJSONEncoding().Build()
+	read := otw.NewReadPipeline[NarrowStruct]().UseJSONEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, NarrowStruct{I: someStruct.I}, i)
+}
+
+func TestJSONUseNumber(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[AnyStruct]().UseJSONEncoding(otw.JSONUseNumber()).Build()
+
+	err := write(AnyStruct{Value: int64(1<<62 + 1)}, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, json.Number("4611686018427387905"), i.Value)
+}
+
+func TestJSONRejectTrailingData(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	appendGarbage := func(b []byte) ([]byte, error) {
+		return append(b, []byte(`{"I":2}`)...), nil
+	}
+
+	read, write := otw.New[NarrowStruct]().
+		UseJSONEncoding(otw.JSONRejectTrailingData()).
+		UseCustomOperation(passthrough, appendGarbage).
+		Build()
+
+	err := write(NarrowStruct{I: 1}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Equal(t, otw.ErrJSONTrailingData, err)
+}
+
+func TestJSONMaxDepth(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[any]().UseJSONEncoding(otw.JSONMaxDepth(3)).Build()
+
+	err := write([]any{[]any{"]]]", []any{}}}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Nil(t, err)
+
+	err = write([]any{[]any{[]any{map[string]any{}}}}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Equal(t, otw.ErrJSONTooDeep, err)
+}
+
+func TestJSONMaxDepthRejectsDeeplyNestedInput(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[string]().UseRawEncoding().Build()
+	read := otw.NewReadPipeline[any]().UseJSONEncoding(otw.JSONMaxDepth(100)).Build()
+
+	err := write(strings.Repeat("[", 10000)+strings.Repeat("]", 10000), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Equal(t, otw.ErrJSONTooDeep, err)
+}
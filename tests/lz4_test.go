@@ -0,0 +1,168 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLZ4CompressionRoundTrip(t *testing.T) {
+	random := make([]byte, 100*1024)
+	rand.Read(random)
+
+	payloads := map[string][]byte{
+		"Empty":         {},
+		"Small":         []byte("hi"),
+		"Repetitive":    []byte(strings.Repeat("on the wire ", 5000)),
+		"LongMatch":     bytes.Repeat([]byte{'a'}, 100*1024),
+		"Random":        random,
+		"RandomTwice":   append(append([]byte{}, random[:1000]...), random[:1000]...),
+		"FarApartMatch": append(append(append([]byte{}, random[:1000]...), random[1000:80*1024]...), random[:1000]...),
+	}
+
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[[]byte]().UseLZ4Compression().Build()
+
+			err := write(payload, buffer)
+			assert.Nil(t, err)
+
+			b, err := read(buffer)
+			assert.Nil(t, err)
+
+			assert.True(t, bytes.Equal(payload, b))
+		})
+	}
+}
+
+func TestLZ4CompressionForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseLZ4Compression().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	s, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, s)
+}
+
+// 20 bytes of 'a' as a standard LZ4 block: 1 literal and a 14 byte match at offset 1, then the 5 literals a block must end with
+var lz4Block = []byte{0x1a, 'a', 0x01, 0x00, 0x50, 'a', 'a', 'a', 'a', 'a'}
+
+func TestLZ4CompressionProducesStandardBlocks(t *testing.T) {
+	var captured []byte
+	_, write := otw.New[[]byte]().
+		UseLZ4Compression().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(bytes.Repeat([]byte{'a'}, 20), bytes.NewBuffer(nil))
+	assert.Nil(t, err)
+
+	assert.Equal(t, byte(6), captured[0])
+	assert.Equal(t, byte(20), captured[1])
+	assert.Equal(t, lz4Block, captured[2:])
+}
+
+func TestLZ4CompressionRejectsCorruptBlocks(t *testing.T) {
+	cases := map[string][]byte{
+		"MissingSize":    {},
+		"Truncated":      append([]byte{20}, lz4Block[:3]...),
+		"WrongSize":      append([]byte{21}, lz4Block...),
+		"OffsetTooFar":   {20, 0x1a, 'a', 0x02, 0x00, 0x50, 'a', 'a', 'a', 'a', 'a'},
+		"ZeroOffset":     {20, 0x1a, 'a', 0x00, 0x00, 0x50, 'a', 'a', 'a', 'a', 'a'},
+		"ImpossibleSize": append([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, lz4Block...),
+	}
+
+	for name, block := range cases {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			write := otw.NewWritePipeline[[]byte]().Build()
+			read := otw.NewReadPipeline[[]byte]().UseLZ4Compression().Build()
+
+			err := write(append([]byte{6}, block...), buffer)
+			assert.Nil(t, err)
+
+			_, err = read(buffer)
+			assert.ErrorIs(t, err, otw.ErrLZ4Corrupt)
+		})
+	}
+}
+
+func benchmarkPayload(b *testing.B, events int) []byte {
+	payload, err := json.Marshal(auditEvents(events))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+func benchmarkCompressedWrite(b *testing.B, events int, compression func(*otw.WritePipeline[[]byte]) *otw.WritePipeline[[]byte]) {
+	payload := benchmarkPayload(b, events)
+	write := compression(otw.NewWritePipeline[[]byte]()).Build()
+
+	buffer := bytes.NewBuffer(nil)
+	b.SetBytes(int64(len(payload)))
+	for b.Loop() {
+		buffer.Reset()
+		if err := write(payload, buffer); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(payload))/float64(buffer.Len()), "ratio")
+}
+
+func benchmarkCompressedRead(b *testing.B, events int, compression func(*otw.Pipeline[[]byte]) *otw.Pipeline[[]byte]) {
+	payload := benchmarkPayload(b, events)
+	read, write := compression(otw.New[[]byte]()).Build()
+
+	written := bytes.NewBuffer(nil)
+	if err := write(payload, written); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(payload)))
+	for b.Loop() {
+		if _, err := read(bytes.NewReader(written.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkZlibCompressionWrite(b *testing.B) {
+	benchmarkCompressedWrite(b, 1000, (*otw.WritePipeline[[]byte]).UseCompression)
+}
+
+func BenchmarkLZ4CompressionWrite(b *testing.B) {
+	benchmarkCompressedWrite(b, 1000, (*otw.WritePipeline[[]byte]).UseLZ4Compression)
+}
+
+func BenchmarkZlibCompressionRead(b *testing.B) {
+	benchmarkCompressedRead(b, 1000, func(p *otw.Pipeline[[]byte]) *otw.Pipeline[[]byte] {
+		return p.UseCompression()
+	})
+}
+
+func BenchmarkLZ4CompressionRead(b *testing.B) {
+	benchmarkCompressedRead(b, 1000, (*otw.Pipeline[[]byte]).UseLZ4Compression)
+}
+
+// Small messages show the fixed cost of compressing each message, such as allocating tables, rather than the throughput
+func BenchmarkZlibCompressionWriteSmall(b *testing.B) {
+	benchmarkCompressedWrite(b, 1, (*otw.WritePipeline[[]byte]).UseCompression)
+}
+
+func BenchmarkLZ4CompressionWriteSmall(b *testing.B) {
+	benchmarkCompressedWrite(b, 1, (*otw.WritePipeline[[]byte]).UseLZ4Compression)
+}
@@ -0,0 +1,115 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type BinaryVersion struct {
+	Major, Minor uint8
+}
+
+func (v BinaryVersion) MarshalBinary() ([]byte, error) {
+	return []byte{'v', v.Major, v.Minor}, nil
+}
+
+func (v *BinaryVersion) UnmarshalBinary(data []byte) error {
+	if len(data) != 3 || data[0] != 'v' {
+		return fmt.Errorf("invalid version")
+	}
+	v.Major, v.Minor = data[1], data[2]
+	return nil
+}
+
+// Also implements the text pair, which should be ignored in favour of the binary pair
+func (v BinaryVersion) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+func (v *BinaryVersion) UnmarshalText(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+type TextPoint struct {
+	X, Y int
+}
+
+func (p *TextPoint) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *TextPoint) UnmarshalText(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+func TestMarshalerEncodedPipelineForBinaryMarshaler(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	var captured []byte
+	read, write := otw.New[BinaryVersion]().
+		UseMarshalerEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(BinaryVersion{Major: 1, Minor: 2}, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'v', 1, 2}, captured)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, BinaryVersion{Major: 1, Minor: 2}, i)
+}
+
+func TestMarshalerEncodedPipelineForTextMarshalerWithPointerReceivers(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	var captured []byte
+	read, write := otw.New[TextPoint]().
+		UseMarshalerEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(TextPoint{X: 3, Y: -4}, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "3,-4", string(captured))
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, TextPoint{X: 3, Y: -4}, i)
+}
+
+func TestMarshalerEncodedPipelineForPointerType(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[*TextPoint]().UseMarshalerEncoding().Build()
+
+	err := write(&TextPoint{X: 5, Y: 6}, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, &TextPoint{X: 5, Y: 6}, i)
+}
+
+func TestMarshalerEncodingFallsBackToGob(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseMarshalerEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, i)
+}
@@ -0,0 +1,131 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// Endlessly repeats the same bytes, as a hostile peer that never ends its message might.
+type endlessReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (e *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = e.pattern[e.offset]
+		e.offset = (e.offset + 1) % len(e.pattern)
+	}
+	return len(p), nil
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	cases := []struct {
+		name    string
+		size    int
+		allowed bool
+	}{
+		{"SingleChunkAtLimit", 1000, true},
+		{"SingleChunkOverLimit", 1001, false},
+		{"ManyChunksAtLimit", 5000, true},
+		{"ManyChunksOverLimit", 5001, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			limit := 1000
+			if c.size > 1024 {
+				limit = 5000
+			}
+
+			read, write := otw.New[[]byte]().UseMaxMessageSize(limit).Build()
+
+			payload := make([]byte, c.size)
+			err := write(payload, buffer)
+			assert.Nil(t, err)
+
+			b, err := read(buffer)
+			if c.allowed {
+				assert.Nil(t, err)
+				assert.Equal(t, payload, b)
+			} else {
+				assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+			}
+		})
+	}
+}
+
+func TestMaxMessageSizeRejectsClaimedLengthBeforeAllocating(t *testing.T) {
+	read := otw.NewReadPipeline[[]byte]().UseMaxMessageSize(1024 * 1024).Build()
+
+	// Claims a chunk of almost 4GB, without the data to back it
+	claim := binary.BigEndian.AppendUint32(nil, 0xfffffff0)
+
+	_, err := read(iotest.OneByteReader(bytes.NewReader(claim)))
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+}
+
+func TestMaxMessageSizeRejectsEndlessChunks(t *testing.T) {
+	read := otw.NewReadPipeline[[]byte]().UseMaxMessageSize(64 * 1024).Build()
+
+	// A chunk of 1024 bytes, over and over, never followed by the empty chunk ending the message
+	chunk := append(binary.BigEndian.AppendUint32(nil, 1024), make([]byte, 1024)...)
+
+	_, err := read(&endlessReader{pattern: chunk})
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+}
+
+func TestMaxMessageSizeAppliesBeforeReadOperations(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]byte]().UseCompression().UseMaxMessageSize(1024).Build()
+
+	// Far larger than the limit, but compresses to far less
+	payload := make([]byte, 64*1024)
+	err := write(payload, buffer)
+	assert.Nil(t, err)
+
+	b, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestMaxMessageSizeWithArmor(t *testing.T) {
+	for name, format := range armorFormats {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := otw.New[[]byte]().UseArmor(format).UseMaxMessageSize(100).Build()
+
+			err := write(make([]byte, 100), buffer)
+			assert.Nil(t, err)
+
+			err = write(make([]byte, 101), buffer)
+			assert.Nil(t, err)
+
+			_, err = read(buffer)
+			assert.Nil(t, err)
+
+			_, err = read(buffer)
+			assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+		})
+	}
+}
+
+func TestMaxMessageSizeRejectsEndlessArmorLines(t *testing.T) {
+	read := otw.NewReadPipeline[[]byte]().UseArmor(otw.ArmorBase64).UseMaxMessageSize(1024).Build()
+
+	_, err := read(&endlessReader{pattern: []byte("QUFB")})
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+
+	_, err = read(strings.NewReader(strings.Repeat("QUFB\n", 1000)))
+	assert.ErrorIs(t, err, otw.ErrMessageTooLarge)
+}
@@ -0,0 +1,296 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type TaggedStruct struct {
+	Name     string            `msgpack:"name" cbor:"name"`
+	Count    int               `msgpack:"count" cbor:"count"`
+	Skipped  string            `msgpack:"-" cbor:"-"`
+	Optional string            `msgpack:"optional,omitempty" cbor:"optional,omitempty"`
+	When     time.Time         `msgpack:"when" cbor:"when"`
+	Tags     []string          `msgpack:"tags" cbor:"tags"`
+	Labels   map[string]string `msgpack:"labels" cbor:"labels"`
+	Child    *TestStruct       `msgpack:"child" cbor:"child"`
+}
+
+var someTaggedStruct = TaggedStruct{
+	Name:   "tagged",
+	Count:  -42,
+	When:   time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC),
+	Tags:   []string{"a", "b", "c"},
+	Labels: map[string]string{"x": "1", "y": "2"},
+	Child:  &someStruct,
+}
+
+func captureBytes(captured *[]byte) func([]byte) ([]byte, error) {
+	return func(b []byte) ([]byte, error) {
+		*captured = append([]byte{}, b...)
+		return b, nil
+	}
+}
+
+func passthrough(b []byte) ([]byte, error) {
+	return b, nil
+}
+
+func TestMsgPackEncodedPipelineForInt(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someNumber := rand.Int()
+
+	read, write := otw.New[int]().UseMsgPackEncoding().Build()
+
+	err := write(someNumber, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someNumber, i)
+}
+
+func TestMsgPackEncodedPipelineForFloat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someFloat := rand.Float32()
+
+	read, write := otw.New[float32]().UseMsgPackEncoding().Build()
+
+	err := write(someFloat, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someFloat, i)
+}
+
+func TestMsgPackEncodedPipelineForString(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someStr := randomString()
+
+	read, write := otw.New[string]().UseMsgPackEncoding().Build()
+
+	err := write(someStr, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStr, i)
+}
+
+func TestMsgPackEncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseMsgPackEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, i)
+}
+
+func TestMsgPackEncodedPipelineForTaggedStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TaggedStruct]().UseMsgPackEncoding().Build()
+
+	withSkipped := someTaggedStruct
+	withSkipped.Skipped = "not sent"
+
+	err := write(withSkipped, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.True(t, someTaggedStruct.When.Equal(i.When))
+	i.When = someTaggedStruct.When
+	assert.Equal(t, someTaggedStruct, i)
+}
+
+func TestMsgPackEncodedPipelineForAny(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[any]().UseMsgPackEncoding().Build()
+
+	err := write(map[string]any{"a": 1, "b": []any{"x", true, nil}}, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]any{"a": int64(1), "b": []any{"x", true, nil}}, i)
+}
+
+func TestMsgPackEncodingWireFormat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	var captured []byte
+	_, write := otw.New[map[string]int]().
+		UseMsgPackEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(map[string]int{"b": 2, "a": -1}, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{0x82, 0xa1, 'a', 0xff, 0xa1, 'b', 0x02}, captured)
+}
+
+func TestMsgPackDecodingRejectsDeeplyNestedArrays(t *testing.T) {
+	// Each 0x91 starts an array holding the next one, deep enough to exhaust the stack without a limit
+	nested := bytes.Repeat([]byte{0x91}, 1_000_000)
+	nested = append(nested, 0xc0)
+
+	t.Run("Any", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+
+		read, write := otw.New[any]().
+			UseMsgPackEncoding().
+			UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return nested, nil }).
+			Build()
+
+		err := write(nil, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.ErrorContains(t, err, "max nesting depth")
+	})
+
+	t.Run("RecursiveType", func(t *testing.T) {
+		type Tree []Tree
+
+		buffer := bytes.NewBuffer(nil)
+
+		read, write := otw.New[Tree]().
+			UseMsgPackEncoding().
+			UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return nested, nil }).
+			Build()
+
+		err := write(nil, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.ErrorContains(t, err, "max nesting depth")
+	})
+}
+
+func TestMsgPackDecodingRejectsUnhashableMapKeys(t *testing.T) {
+	// A map holding one entry whose key is the array [1] and whose value is 2
+	payload := []byte{0x81, 0x91, 0x01, 0x02}
+
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[map[any]int]().
+		UseMsgPackEncoding().
+		UseCustomOperation(passthrough, func([]byte) ([]byte, error) { return payload, nil }).
+		Build()
+
+	err := write(nil, buffer)
+	assert.Nil(t, err)
+
+	assert.NotPanics(t, func() {
+		_, err = read(buffer)
+	})
+	assert.ErrorContains(t, err, "unsupported map key")
+}
+
+func TestMsgPackDecodingRejectsUint64OverflowingInt64(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[uint64]().UseMsgPackEncoding().Build()
+	read := otw.NewReadPipeline[int64]().UseMsgPackEncoding().Build()
+
+	err := write(1<<63+5, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorContains(t, err, "overflows int64")
+}
+
+type Inner struct {
+	Name  string
+	Depth int
+}
+
+type OtherInner struct {
+	Name string
+}
+
+type Outer struct {
+	Inner
+	Name string
+}
+
+type OuterPointer struct {
+	*Inner
+	Label string
+}
+
+type OuterClash struct {
+	Inner
+	OtherInner
+}
+
+func TestStructFieldPromotion(t *testing.T) {
+	codecs := map[string]func(*otw.Pipeline[any]) *otw.Pipeline[any]{
+		"MsgPack": (*otw.Pipeline[any]).UseMsgPackEncoding,
+		"CBOR":    (*otw.Pipeline[any]).UseCBOREncoding,
+	}
+
+	cases := []struct {
+		name     string
+		value    any
+		expected map[string]any
+	}{
+		{"OuterFieldWins", Outer{Inner: Inner{Name: "inner", Depth: 1}, Name: "outer"}, map[string]any{"Name": "outer", "Depth": int64(1)}},
+		{"PointerEmbedPromoted", OuterPointer{Inner: &Inner{Name: "inner", Depth: 2}, Label: "x"}, map[string]any{"Name": "inner", "Depth": int64(2), "Label": "x"}},
+		{"NilPointerEmbedSkipped", OuterPointer{Label: "x"}, map[string]any{"Label": "x"}},
+		{"ClashingFieldsDropped", OuterClash{Inner: Inner{Name: "a", Depth: 3}, OtherInner: OtherInner{Name: "b"}}, map[string]any{"Depth": int64(3)}},
+	}
+
+	for codec, use := range codecs {
+		for _, c := range cases {
+			t.Run(codec+"/"+c.name, func(t *testing.T) {
+				buffer := bytes.NewBuffer(nil)
+
+				read, write := use(otw.New[any]()).Build()
+
+				err := write(c.value, buffer)
+				assert.Nil(t, err)
+
+				m, err := read(buffer)
+				assert.Nil(t, err)
+				assert.Equal(t, c.expected, m)
+			})
+		}
+	}
+}
+
+func TestStructFieldPromotionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[OuterPointer]().UseMsgPackEncoding().Build()
+
+	value := OuterPointer{Inner: &Inner{Name: "inner", Depth: 2}, Label: "x"}
+	err := write(value, buffer)
+	assert.Nil(t, err)
+
+	o, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, value, o)
+}
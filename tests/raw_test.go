@@ -0,0 +1,118 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Blob []byte
+
+func TestRawEncodedPipelineForBytes(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someBytes := []byte(randomString())
+
+	var captured []byte
+	read, write := otw.New[[]byte]().
+		UseRawEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(someBytes, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, someBytes, captured)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someBytes, i)
+}
+
+func TestRawEncodedPipelineForString(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someStr := randomString()
+
+	var captured []byte
+	read, write := otw.New[string]().
+		UseRawEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(someStr, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(someStr), captured)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStr, i)
+}
+
+func TestRawEncodedPipelineForReader(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someStr := strings.Repeat(randomString(), 100)
+
+	read, write := otw.New[io.Reader]().UseRawEncoding().UseCompression().Build()
+
+	err := write(strings.NewReader(someStr), buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	data, err := io.ReadAll(i)
+	assert.Nil(t, err)
+	assert.Equal(t, someStr, string(data))
+}
+
+func TestRawEncodingIsDefaultForRawTypes(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someBlob := Blob(randomString())
+
+	var captured []byte
+	read, write := otw.New[Blob]().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(someBlob, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(someBlob), captured)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someBlob, i)
+}
+
+func TestRawEncodingFailsAtBuildForOtherTypes(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[TestStruct]().UseRawEncoding().Build()
+	})
+}
+
+func TestRawEncodingIsNotDefaultForSlicesOfNamedBytes(t *testing.T) {
+	type MyByte byte
+
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]MyByte]().Build()
+
+	err := write([]MyByte("hello"), buffer)
+	assert.Nil(t, err)
+
+	b, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []MyByte("hello"), b)
+
+	assert.Panics(t, func() {
+		otw.New[[]MyByte]().UseRawEncoding().Build()
+	})
+}
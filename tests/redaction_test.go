@@ -0,0 +1,149 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log/slog"
+	"os"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Login struct {
+	User     string
+	Password string `otw:"secret"`
+}
+
+type Session struct {
+	ID     int
+	Logins []Login
+}
+
+// Captures debug logs for the duration of the test, restoring the usual error-only logger afterwards.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	logs := bytes.NewBuffer(nil)
+	otw.SetLogger(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	t.Cleanup(func() {
+		otw.SetLogger(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+		otw.SetPayloadLogging(true)
+	})
+
+	return logs
+}
+
+func TestSecretFieldsAreRedactedFromLogs(t *testing.T) {
+	codecs := map[string]*otw.Pipeline[Session]{
+		"Gob":     otw.New[Session]().UseGobEncoding(),
+		"JSON":    otw.New[Session]().UseJSONEncoding(),
+		"XML":     otw.New[Session]().UseXMLEncoding(),
+		"MsgPack": otw.New[Session]().UseMsgPackEncoding(),
+		"CBOR":    otw.New[Session]().UseCBOREncoding(),
+	}
+
+	for name, pipeline := range codecs {
+		t.Run(name, func(t *testing.T) {
+			logs := captureLogs(t)
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := pipeline.Build()
+
+			session := Session{ID: 7, Logins: []Login{{User: "ada", Password: "hunter2"}}}
+			err := write(session, buffer)
+			assert.Nil(t, err)
+
+			s, err := read(buffer)
+			assert.Nil(t, err)
+			assert.Equal(t, session, s)
+
+			assert.NotContains(t, logs.String(), "hunter2")
+			assert.Contains(t, logs.String(), "Instance.Logins.0.User=ada")
+			assert.Contains(t, logs.String(), "Instance.Logins.0.Password=[REDACTED]")
+		})
+	}
+}
+
+func TestPayloadLoggingCanBeDisabled(t *testing.T) {
+	logs := captureLogs(t)
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseJSONEncoding().Build()
+
+	otw.SetPayloadLogging(false)
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Nil(t, err)
+
+	assert.NotContains(t, logs.String(), someStruct.S)
+	assert.Contains(t, logs.String(), "[REDACTED]")
+}
+
+func TestPayloadLoggingEnabledByDefault(t *testing.T) {
+	logs := captureLogs(t)
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseJSONEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.Nil(t, err)
+
+	assert.Contains(t, logs.String(), someStruct.S)
+}
+
+type LoginEnvelope struct {
+	Kind    string
+	Payload any
+}
+
+func TestSecretFieldsWithinInterfacesAreRedactedFromLogs(t *testing.T) {
+	gob.Register(Login{})
+
+	codecs := map[string]*otw.Pipeline[LoginEnvelope]{
+		"Gob":     otw.New[LoginEnvelope]().UseGobEncoding(),
+		"JSON":    otw.New[LoginEnvelope]().UseJSONEncoding(),
+		"MsgPack": otw.New[LoginEnvelope]().UseMsgPackEncoding(),
+		"CBOR":    otw.New[LoginEnvelope]().UseCBOREncoding(),
+	}
+
+	for name, pipeline := range codecs {
+		t.Run(name, func(t *testing.T) {
+			logs := captureLogs(t)
+			buffer := bytes.NewBuffer(nil)
+
+			_, write := pipeline.Build()
+
+			err := write(LoginEnvelope{Kind: "login", Payload: Login{User: "ada", Password: "hunter2"}}, buffer)
+			assert.Nil(t, err)
+
+			assert.NotContains(t, logs.String(), "hunter2")
+		})
+	}
+
+	t.Run("Decoded", func(t *testing.T) {
+		logs := captureLogs(t)
+		buffer := bytes.NewBuffer(nil)
+
+		read, write := otw.New[LoginEnvelope]().UseGobEncoding().Build()
+
+		envelope := LoginEnvelope{Kind: "login", Payload: Login{User: "ada", Password: "hunter2"}}
+		err := write(envelope, buffer)
+		assert.Nil(t, err)
+
+		e, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, envelope, e)
+
+		assert.NotContains(t, logs.String(), "hunter2")
+		assert.Contains(t, logs.String(), "Instance.Kind=login")
+		assert.Contains(t, logs.String(), "Instance.Payload.User=ada")
+		assert.Contains(t, logs.String(), "Instance.Payload.Password=[REDACTED]")
+	})
+}
@@ -0,0 +1,210 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type UserV1 struct {
+	Name string
+}
+
+type UserV2 struct {
+	FirstName string
+	LastName  string
+}
+
+type UserV3 struct {
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+func userSchema() *otw.Schema {
+	s := otw.NewSchema(3)
+	otw.AddSchemaUpgrade(s, 1, func(u UserV1) (UserV2, error) {
+		first, last, _ := strings.Cut(u.Name, " ")
+		return UserV2{FirstName: first, LastName: last}, nil
+	})
+	otw.AddSchemaUpgrade(s, 2, func(u UserV2) (UserV3, error) {
+		return UserV3{FirstName: u.FirstName, LastName: u.LastName, Email: "unknown"}, nil
+	})
+	return s
+}
+
+func TestSchemaCurrentVersionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someUser := UserV3{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}
+
+	read, write := otw.New[UserV3]().UseJSONEncoding().UseSchema(userSchema()).Build()
+
+	err := write(someUser, buffer)
+	assert.Nil(t, err)
+
+	u, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someUser, u)
+}
+
+func TestSchemaUpgradesOlderVersions(t *testing.T) {
+	read := otw.NewReadPipeline[UserV3]().UseJSONEncoding().UseSchema(userSchema()).Build()
+
+	buffer := bytes.NewBuffer(nil)
+	writeV1 := otw.NewWritePipeline[UserV1]().UseJSONEncoding().UseSchemaVersion(1).Build()
+	err := writeV1(UserV1{Name: "Ada Lovelace"}, buffer)
+	assert.Nil(t, err)
+
+	u, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, UserV3{FirstName: "Ada", LastName: "Lovelace", Email: "unknown"}, u)
+
+	writeV2 := otw.NewWritePipeline[UserV2]().UseJSONEncoding().UseSchemaVersion(2).Build()
+	err = writeV2(UserV2{FirstName: "Grace", LastName: "Hopper"}, buffer)
+	assert.Nil(t, err)
+
+	u, err = read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, UserV3{FirstName: "Grace", LastName: "Hopper", Email: "unknown"}, u)
+}
+
+func TestSchemaUpgradesWithGobEncoding(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read := otw.NewReadPipeline[UserV3]().UseCompression().UseSchema(userSchema()).Build()
+	write := otw.NewWritePipeline[UserV1]().UseCompression().UseSchemaVersion(1).Build()
+
+	err := write(UserV1{Name: "Ada Lovelace"}, buffer)
+	assert.Nil(t, err)
+
+	u, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, UserV3{FirstName: "Ada", LastName: "Lovelace", Email: "unknown"}, u)
+}
+
+func TestSchemaRejectsUnknownVersions(t *testing.T) {
+	read := otw.NewReadPipeline[UserV3]().UseJSONEncoding().UseSchema(userSchema()).Build()
+
+	for _, version := range []int{0, 4} {
+		buffer := bytes.NewBuffer(nil)
+
+		write := otw.NewWritePipeline[UserV3]().UseJSONEncoding().UseSchemaVersion(version).Build()
+		err := write(UserV3{}, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.ErrorIs(t, err, otw.ErrUnknownSchemaVersion)
+	}
+}
+
+func TestSchemaRejectsMissingVersion(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read := otw.NewReadPipeline[[]byte]().UseSchema(otw.NewSchema(1)).Build()
+	write := otw.NewWritePipeline[[]byte]().Build()
+
+	err := write([]byte{1}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrSchemaVersionMissing)
+}
+
+func TestSchemaUpgradeErrorIsReturned(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	errRejected := fmt.Errorf("rejected")
+	s := otw.NewSchema(2)
+	otw.AddSchemaUpgrade(s, 1, func(u UserV1) (UserV2, error) {
+		return UserV2{}, errRejected
+	})
+
+	read := otw.NewReadPipeline[UserV2]().UseMsgPackEncoding().UseSchema(s).Build()
+	write := otw.NewWritePipeline[UserV1]().UseMsgPackEncoding().UseSchemaVersion(1).Build()
+
+	err := write(UserV1{Name: "Ada"}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, errRejected)
+}
+
+func TestSchemaFailsAtBuildForBrokenChain(t *testing.T) {
+	assert.Panics(t, func() {
+		s := otw.NewSchema(3)
+		otw.AddSchemaUpgrade(s, 1, func(u UserV1) (UserV2, error) { return UserV2{}, nil })
+		otw.New[UserV3]().UseSchema(s).Build()
+	})
+
+	assert.Panics(t, func() {
+		s := otw.NewSchema(2)
+		otw.AddSchemaUpgrade(s, 1, func(u UserV1) (UserV3, error) { return UserV3{}, nil })
+		otw.New[UserV2]().UseSchema(s).Build()
+	})
+
+	assert.Panics(t, func() {
+		type Point struct{ X, Y int32 }
+		s := otw.NewSchema(2)
+		otw.AddSchemaUpgrade(s, 1, func(p [2]int32) (Point, error) { return Point{p[0], p[1]}, nil })
+		otw.New[Point]().UseBinaryEncoding(binary.BigEndian).UseSchema(s).Build()
+	})
+}
+
+func TestSchemaUpgradesOlderVersionsWithTypeRegistry(t *testing.T) {
+	type PingV1 struct {
+		Seq int
+	}
+
+	s := otw.NewSchema(2)
+	otw.AddSchemaUpgrade(s, 1, func(p PingV1) (Message, error) {
+		return Ping{Sequence: p.Seq}, nil
+	})
+
+	oldRegistry := otw.NewTypeRegistry()
+	otw.RegisterType[PingV1](oldRegistry, "ping")
+
+	cases := map[string]struct {
+		writeV1 func(PingV1, io.Writer) error
+		writeV2 func(Message, io.Writer) error
+		read    func(io.Reader) (Message, error)
+	}{
+		"JSON": {
+			otw.NewWritePipeline[PingV1]().UseJSONEncoding().UseTypeRegistry(oldRegistry).UseSchemaVersion(1).Build(),
+			otw.NewWritePipeline[Message]().UseJSONEncoding().UseTypeRegistry(messageRegistry()).UseSchemaVersion(2).Build(),
+			otw.NewReadPipeline[Message]().UseJSONEncoding().UseTypeRegistry(messageRegistry()).UseSchema(s).Build(),
+		},
+		"Gob": {
+			otw.NewWritePipeline[PingV1]().UseGobEncoding().UseTypeRegistry(oldRegistry).UseSchemaVersion(1).Build(),
+			otw.NewWritePipeline[Message]().UseGobEncoding().UseTypeRegistry(messageRegistry()).UseSchemaVersion(2).Build(),
+			otw.NewReadPipeline[Message]().UseGobEncoding().UseTypeRegistry(messageRegistry()).UseSchema(s).Build(),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			err := c.writeV1(PingV1{Seq: 7}, buffer)
+			assert.Nil(t, err)
+
+			err = c.writeV2(Chat{From: "ada", Text: "hi"}, buffer)
+			assert.Nil(t, err)
+
+			m, err := c.read(buffer)
+			assert.Nil(t, err)
+			assert.Equal(t, Ping{Sequence: 7}, m)
+
+			m, err = c.read(buffer)
+			assert.Nil(t, err)
+			assert.Equal(t, Chat{From: "ada", Text: "hi"}, m)
+		})
+	}
+}
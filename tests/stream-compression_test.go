@@ -0,0 +1,254 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamCompressionRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[AuditEvent]().UseJSONEncoding().UseStreamCompression(flate.DefaultCompression).Build()
+
+	events := auditEvents(100)
+	for _, event := range events {
+		err := write(event, buffer)
+		assert.Nil(t, err)
+	}
+
+	for _, event := range events {
+		e, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, event, e)
+	}
+}
+
+func TestStreamCompressionBeatsPerMessageCompression(t *testing.T) {
+	events := auditEvents(100)
+
+	perMessage := bytes.NewBuffer(nil)
+	_, write := otw.New[AuditEvent]().UseJSONEncoding().UseCompression().Build()
+	for _, event := range events {
+		err := write(event, perMessage)
+		assert.Nil(t, err)
+	}
+
+	streamed := bytes.NewBuffer(nil)
+	_, write = otw.New[AuditEvent]().UseJSONEncoding().UseStreamCompression(flate.BestCompression).Build()
+	for _, event := range events {
+		err := write(event, streamed)
+		assert.Nil(t, err)
+	}
+
+	assert.Less(t, streamed.Len(), perMessage.Len()/2)
+}
+
+func TestStreamCompressionRefersBackToEarlierMessages(t *testing.T) {
+	var captured []byte
+	_, write := otw.New[AuditEvent]().
+		UseJSONEncoding().
+		UseStreamCompression(flate.BestCompression).
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	event := auditEvents(1)[0]
+	buffer := bytes.NewBuffer(nil)
+
+	err := write(event, buffer)
+	assert.Nil(t, err)
+	first := len(captured)
+
+	err = write(event, buffer)
+	assert.Nil(t, err)
+
+	assert.Less(t, len(captured), first/4)
+}
+
+func TestStreamCompressionKeepsStreamsSeparate(t *testing.T) {
+	first, second := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	read, write := otw.New[string]().UseStreamCompression(flate.BestSpeed).Build()
+
+	for i := range 10 {
+		err := write(hex.EncodeToString([]byte{byte(i)})+" first", first)
+		assert.Nil(t, err)
+
+		err = write(hex.EncodeToString([]byte{byte(i)})+" second", second)
+		assert.Nil(t, err)
+	}
+
+	for i := range 10 {
+		s, err := read(second)
+		assert.Nil(t, err)
+		assert.Equal(t, hex.EncodeToString([]byte{byte(i)})+" second", s)
+	}
+
+	for i := range 10 {
+		s, err := read(first)
+		assert.Nil(t, err)
+		assert.Equal(t, hex.EncodeToString([]byte{byte(i)})+" first", s)
+	}
+}
+
+func TestStreamCompressionHistoryBeyondWindow(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[[]byte]().UseStreamCompression(flate.DefaultCompression).Build()
+
+	// Repeats of earlier chunks, spread over more than the 32KB window
+	chunks := make([][]byte, 8)
+	for i := range chunks {
+		chunks[i] = make([]byte, 3000)
+		rand.Read(chunks[i])
+	}
+
+	payloads := make([][]byte, 0)
+	for i := range 60 {
+		payloads = append(payloads, chunks[(i*5)%len(chunks)])
+	}
+
+	for _, payload := range payloads {
+		err := write(payload, buffer)
+		assert.Nil(t, err)
+	}
+
+	for _, payload := range payloads {
+		b, err := read(buffer)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, b)
+	}
+}
+
+func TestStreamCompressionDetectsMismatch(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[string]().UseCompression().Build()
+	read := otw.NewReadPipeline[string]().UseStreamCompression().Build()
+
+	err := write("Hello, World!", buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrCompressionMismatch)
+}
+
+func TestStreamCompressionAppliesDecompressionLimits(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	write := otw.NewWritePipeline[[]byte]().UseStreamCompression(flate.BestSpeed).Build()
+	read := otw.NewReadPipeline[[]byte]().UseStreamCompression(otw.MaxDecompressedSize(1024)).Build()
+
+	err := write(make([]byte, 1025), buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrDecompressedTooLarge)
+}
+
+func TestStreamCompressionFailsAtBuildForInvalidLevel(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.New[string]().UseStreamCompression(42).Build()
+	})
+}
+
+func TestStreamCompressionStartsAfreshWhenReleased(t *testing.T) {
+	var captured []byte
+	p := otw.New[AuditEvent]().
+		UseJSONEncoding().
+		UseStreamCompression(flate.BestCompression).
+		UseCustomOperation(passthrough, captureBytes(&captured))
+	read, write := p.Build()
+
+	event := auditEvents(1)[0]
+	buffer := bytes.NewBuffer(nil)
+
+	for range 2 {
+		err := write(event, buffer)
+		assert.Nil(t, err)
+
+		_, err = read(buffer)
+		assert.Nil(t, err)
+	}
+	repeated := len(captured)
+
+	p.Release(buffer)
+
+	// Nothing refers back to the messages before the release, on either end
+	err := write(event, buffer)
+	assert.Nil(t, err)
+	assert.Greater(t, len(captured), repeated*4)
+
+	e, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, event, e)
+}
+
+func TestStreamCompressionReleaseDropsStream(t *testing.T) {
+	p := otw.New[AuditEvent]().UseJSONEncoding().UseStreamCompression(flate.BestCompression)
+	_, write := p.Build()
+	// The pipeline remains in use, as it would on a server
+	defer runtime.KeepAlive(write)
+
+	collected := make(chan struct{})
+	func() {
+		buffer := bytes.NewBuffer(nil)
+		runtime.SetFinalizer(buffer, func(*bytes.Buffer) { close(collected) })
+
+		err := write(auditEvents(1)[0], buffer)
+		assert.Nil(t, err)
+
+		p.Release(buffer)
+	}()
+
+	for range 10 {
+		runtime.GC()
+		select {
+		case <-collected:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("stream was still referenced after being released")
+}
+
+func TestStreamCompressionKeepsStreamAfterRejectedMessage(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	rejectLogins := func(e AuditEvent) error {
+		if e.Action == "login" {
+			return errors.New("bad")
+		}
+		return nil
+	}
+
+	read, write := otw.New[AuditEvent]().
+		UseJSONEncoding().
+		UseStreamCompression(flate.BestCompression).
+		UseValidator(rejectLogins).
+		Build()
+
+	events := auditEvents(20)
+	for _, event := range events {
+		err := write(event, buffer)
+		assert.Nil(t, err)
+	}
+
+	for _, event := range events {
+		e, err := read(buffer)
+		if event.Action == "login" {
+			assert.EqualError(t, err, "bad")
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, event, e)
+	}
+}
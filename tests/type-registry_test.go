@@ -0,0 +1,176 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Message interface {
+	Kind() string
+}
+
+type Ping struct {
+	Sequence int
+}
+
+func (Ping) Kind() string { return "ping" }
+
+type Chat struct {
+	From string
+	Text string
+}
+
+func (Chat) Kind() string { return "chat" }
+
+type Unregistered struct{}
+
+func (Unregistered) Kind() string { return "unregistered" }
+
+func messageRegistry() *otw.TypeRegistry {
+	reg := otw.NewTypeRegistry()
+	otw.RegisterType[Ping](reg, "ping")
+	otw.RegisterType[Chat](reg, "chat")
+	return reg
+}
+
+func TestTypeRegistryReturnsConcreteTypes(t *testing.T) {
+	pipelines := map[string]*otw.Pipeline[Message]{
+		"Gob":     otw.New[Message]().UseGobEncoding(),
+		"JSON":    otw.New[Message]().UseJSONEncoding(),
+		"MsgPack": otw.New[Message]().UseMsgPackEncoding(),
+		"CBOR":    otw.New[Message]().UseCBOREncoding(),
+	}
+
+	for name, pipeline := range pipelines {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+
+			read, write := pipeline.UseTypeRegistry(messageRegistry()).UseCompression().Build()
+
+			messages := []Message{Ping{Sequence: 1}, Chat{From: "ada", Text: randomString()}, Ping{Sequence: 2}}
+			for _, msg := range messages {
+				err := write(msg, buffer)
+				assert.Nil(t, err)
+			}
+
+			for _, expected := range messages {
+				msg, err := read(buffer)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, msg)
+			}
+		})
+	}
+}
+
+func TestTypeRegistryWorksWithAny(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	reg := messageRegistry()
+	otw.RegisterType[string](reg, "string")
+
+	read, write := otw.New[any]().UseTypeRegistry(reg).Build()
+
+	err := write("hello", buffer)
+	assert.Nil(t, err)
+
+	msg, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", msg)
+}
+
+func TestTypeRegistryRejectsUnregisteredType(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	_, write := otw.New[Message]().UseTypeRegistry(messageRegistry()).Build()
+
+	err := write(Unregistered{}, buffer)
+	assert.ErrorIs(t, err, otw.ErrUnregisteredType)
+}
+
+func TestTypeRegistryRejectsUnknownTag(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	writerRegistry := messageRegistry()
+	otw.RegisterType[Unregistered](writerRegistry, "unregistered")
+
+	write := otw.NewWritePipeline[Message]().UseTypeRegistry(writerRegistry).Build()
+	read := otw.NewReadPipeline[Message]().UseTypeRegistry(messageRegistry()).Build()
+
+	err := write(Unregistered{}, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, otw.ErrUnknownTypeTag)
+}
+
+func TestTypeRegistryPanicsOnConflictingRegistration(t *testing.T) {
+	assert.Panics(t, func() {
+		otw.RegisterType[Chat](messageRegistry(), "ping")
+	})
+
+	assert.Panics(t, func() {
+		otw.RegisterType[Ping](messageRegistry(), "pong")
+	})
+
+	assert.NotPanics(t, func() {
+		otw.RegisterType[Ping](messageRegistry(), "ping")
+	})
+}
+
+func TestTypeRegistryFailsAtBuild(t *testing.T) {
+	assert.Panics(t, func() {
+		reg := messageRegistry()
+		otw.RegisterType[string](reg, "string")
+		otw.New[Message]().UseTypeRegistry(reg).Build()
+	})
+
+	assert.Panics(t, func() {
+		otw.New[Message]().UseGobStreamEncoding().UseTypeRegistry(messageRegistry()).Build()
+	})
+}
+
+func TestDispatcherRoutesToTypedHandlers(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[Message]().UseJSONEncoding().UseTypeRegistry(messageRegistry()).Build()
+
+	var pings []int
+	var chats []string
+
+	d := otw.NewDispatcher()
+	otw.Handle(d, func(p Ping) error {
+		pings = append(pings, p.Sequence)
+		return nil
+	})
+	otw.Handle(d, func(c Chat) error {
+		chats = append(chats, c.Text)
+		return nil
+	})
+
+	for _, msg := range []Message{Ping{Sequence: 1}, Chat{Text: "hi"}, Ping{Sequence: 2}} {
+		err := write(msg, buffer)
+		assert.Nil(t, err)
+	}
+
+	err := otw.Serve(d, read, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []int{1, 2}, pings)
+	assert.Equal(t, []string{"hi"}, chats)
+}
+
+func TestDispatcherErrors(t *testing.T) {
+	errStop := fmt.Errorf("stop")
+
+	d := otw.NewDispatcher()
+	otw.Handle(d, func(p Ping) error {
+		return errStop
+	})
+
+	assert.ErrorIs(t, d.Dispatch(Ping{}), errStop)
+	assert.ErrorIs(t, d.Dispatch(Chat{}), otw.ErrNoHandler)
+}
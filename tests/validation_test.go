@@ -0,0 +1,164 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Address struct {
+	Lines    []string `validate:"min=1,max=3"`
+	Postcode string   `validate:"required,regex=^[0-9]{4,5}$"`
+}
+
+type Account struct {
+	Name      string            `validate:"required,max=16"`
+	Age       int               `validate:"min=18,max=130"`
+	Country   string            `validate:"len=2"`
+	Nickname  *string           `validate:"min=3"`
+	Addresses []Address         `validate:"required"`
+	Labels    map[string]string `validate:"max=2"`
+}
+
+var someAccount = Account{
+	Name:      "Ada",
+	Age:       36,
+	Country:   "GB",
+	Addresses: []Address{{Lines: []string{"12 St James's Square"}, Postcode: "1234"}},
+}
+
+func TestUseStructValidationAcceptsValidValue(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[Account]().UseStructValidation().Build()
+
+	err := write(someAccount, buffer)
+	assert.Nil(t, err)
+
+	a, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someAccount, a)
+}
+
+func TestUseStructValidationReportsFieldPaths(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[Account]().UseJSONEncoding().UseStructValidation().Build()
+
+	nickname := "Al"
+	invalid := Account{
+		Name:     "",
+		Age:      12,
+		Country:  "GBR",
+		Nickname: &nickname,
+		Addresses: []Address{
+			{Lines: []string{"1"}, Postcode: "1234"},
+			{Postcode: "12,34"},
+		},
+	}
+
+	err := write(invalid, buffer)
+	assert.Nil(t, err)
+
+	_, err = read(buffer)
+
+	var validationErr *otw.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []otw.FieldError{
+		{Path: "Name", Rule: "required", Message: "is required"},
+		{Path: "Age", Rule: "min", Message: "must be at least 18"},
+		{Path: "Country", Rule: "len", Message: "must have length 2"},
+		{Path: "Nickname", Rule: "min", Message: "must have length at least 3"},
+		{Path: "Addresses[1].Lines", Rule: "min", Message: "must have length at least 1"},
+		{Path: "Addresses[1].Postcode", Rule: "regex", Message: "must match ^[0-9]{4,5}$"},
+	}, validationErr.Fields)
+}
+
+func TestValidateStructNestedInMaps(t *testing.T) {
+	type Directory struct {
+		Entries map[string]Address
+	}
+
+	err := otw.ValidateStruct(Directory{Entries: map[string]Address{"home": {Lines: []string{"1"}}}})
+
+	var validationErr *otw.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "Entries[home].Postcode", validationErr.Fields[0].Path)
+}
+
+func TestValidateStructSkipsValuesWithoutRules(t *testing.T) {
+	type Upload struct {
+		Name string `validate:"required"`
+		Data []byte
+		Rows [][]int
+		Meta any
+	}
+
+	upload := Upload{
+		Name: "big",
+		Data: make([]byte, 8<<20),
+		Rows: make([][]int, 1<<16),
+		Meta: []Address{{Lines: []string{"1"}, Postcode: "1234"}},
+	}
+
+	// Elements that can't hold rules aren't visited, so there is no per element work
+	allocs := testing.AllocsPerRun(1, func() {
+		assert.Nil(t, otw.ValidateStruct(upload))
+	})
+	assert.Less(t, allocs, float64(1000))
+
+	upload.Meta = []Address{{Lines: []string{"1"}}}
+	var validationErr *otw.ValidationError
+	assert.True(t, errors.As(otw.ValidateStruct(upload), &validationErr))
+	assert.Equal(t, "Meta[0].Postcode", validationErr.Fields[0].Path)
+}
+
+func TestUseValidatorRunsCustomChecks(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	errOdd := fmt.Errorf("odd numbers are not allowed")
+	read, write := otw.New[int]().UseValidator(func(i int) error {
+		if i%2 != 0 {
+			return errOdd
+		}
+		return nil
+	}).Build()
+
+	err := write(4, buffer)
+	assert.Nil(t, err)
+
+	err = write(5, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, i)
+
+	_, err = read(buffer)
+	assert.ErrorIs(t, err, errOdd)
+}
+
+func TestUseStructValidationFailsAtBuildForBadTags(t *testing.T) {
+	type UnknownRule struct {
+		Name string `validate:"shiny"`
+	}
+	type BadRegex struct {
+		Name string `validate:"regex=("`
+	}
+	type LengthOfNumber struct {
+		Count int `validate:"len=2"`
+	}
+	type Nested struct {
+		Inner []BadRegex
+	}
+
+	assert.Panics(t, func() { otw.New[UnknownRule]().UseStructValidation().Build() })
+	assert.Panics(t, func() { otw.New[BadRegex]().UseStructValidation().Build() })
+	assert.Panics(t, func() { otw.New[LengthOfNumber]().UseStructValidation().Build() })
+	assert.Panics(t, func() { otw.New[Nested]().UseStructValidation().Build() })
+}
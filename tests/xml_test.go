@@ -0,0 +1,123 @@
+package onthewire_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math/rand"
+	"testing"
+
+	otw "github.com/EddisonKing/on-the-wire"
+	"github.com/stretchr/testify/assert"
+)
+
+type Envelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Action  string   `xml:"action,attr"`
+	Body    string   `xml:"Body"`
+	Items   []string `xml:"Items>Item"`
+}
+
+func TestXMLEncodedPipelineForInt(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someNumber := rand.Int()
+
+	read, write := otw.New[int]().UseXMLEncoding().Build()
+
+	err := write(someNumber, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someNumber, i)
+}
+
+func TestXMLEncodedPipelineForFloat(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someFloat := rand.Float32()
+
+	read, write := otw.New[float32]().UseXMLEncoding().Build()
+
+	err := write(someFloat, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someFloat, i)
+}
+
+func TestXMLEncodedPipelineForBool(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someBool := !(rand.Float32() > 0.5)
+
+	read, write := otw.New[bool]().UseXMLEncoding().Build()
+
+	err := write(someBool, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someBool, i)
+}
+
+func TestXMLEncodedPipelineForString(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	someStr := randomString()
+
+	read, write := otw.New[string]().UseXMLEncoding().Build()
+
+	err := write(someStr, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStr, i)
+}
+
+func TestXMLEncodedPipelineForStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	read, write := otw.New[TestStruct]().UseXMLEncoding().Build()
+
+	err := write(someStruct, buffer)
+	assert.Nil(t, err)
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, someStruct, i)
+}
+
+func TestXMLEncodedPipelineForTaggedStruct(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+
+	envelope := Envelope{
+		XMLName: xml.Name{Local: "Envelope"},
+		Action:  "update",
+		Body:    "Hello",
+		Items:   []string{"a", "b"},
+	}
+
+	var captured []byte
+	read, write := otw.New[Envelope]().
+		UseXMLEncoding().
+		UseCustomOperation(passthrough, captureBytes(&captured)).
+		Build()
+
+	err := write(envelope, buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `<Envelope action="update"><Body>Hello</Body><Items><Item>a</Item><Item>b</Item></Items></Envelope>`, string(captured))
+
+	i, err := read(buffer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, envelope, i)
+}
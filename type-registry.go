@@ -0,0 +1,129 @@
+package onthewire
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrUnregisteredType = fmt.Errorf("type is not registered")
+	ErrUnknownTypeTag   = fmt.Errorf("type tag is unknown")
+)
+
+// Maps the concrete types that can be sent over a pipeline to the tags written in the frame to identify them.
+//
+// Create one with NewTypeRegistry, add types with RegisterType and use it with UseTypeRegistry on both ends of a pipeline, typically with T being an interface that the registered types implement.
+type TypeRegistry struct {
+	types map[string]reflect.Type
+	tags  map[reflect.Type]string
+}
+
+// Creates an empty type registry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		types: make(map[string]reflect.Type),
+		tags:  make(map[reflect.Type]string),
+	}
+}
+
+// Registers T under the given tag. Both ends of a pipeline must register the same types under the same tags, and types should be registered before the pipeline is built.
+//
+// RegisterType panics if the tag or T has already been registered with something else, since messages would otherwise be decoded as the wrong type.
+func RegisterType[T any](reg *TypeRegistry, tag string) *TypeRegistry {
+	typ := reflect.TypeFor[T]()
+
+	if existing, ok := reg.types[tag]; ok && existing != typ {
+		panic(fmt.Errorf("type registry: tag %q is already registered to %s", tag, existing))
+	}
+	if existing, ok := reg.tags[typ]; ok && existing != tag {
+		panic(fmt.Errorf("type registry: %s is already registered with tag %q", typ, existing))
+	}
+
+	reg.types[tag] = typ
+	reg.tags[typ] = tag
+	return reg
+}
+
+// Checks that every registered type can be returned as target.
+func (reg *TypeRegistry) check(target reflect.Type, canUnmarshal bool) error {
+	if !canUnmarshal {
+		return fmt.Errorf("type registry: the selected encoding cannot decode registered types as %s", target)
+	}
+
+	for tag, typ := range reg.types {
+		if !typ.AssignableTo(target) {
+			return fmt.Errorf("type registry: %s registered with tag %q cannot be used as %s", typ, tag, target)
+		}
+	}
+
+	return nil
+}
+
+// Wraps encoder to write the tag of the concrete type of each value ahead of the encoded value.
+func typeRegistryEncoder[W any](reg *TypeRegistry, encoder func(W) ([]byte, error)) func(W) ([]byte, error) {
+	return func(t W) ([]byte, error) {
+		typ := reflect.TypeOf(t)
+		tag, ok := reg.tags[typ]
+		if !ok {
+			logger.Error("Failed to write message. The type is not registered", "Type", typ)
+			return nil, fmt.Errorf("%w: %v", ErrUnregisteredType, typ)
+		}
+
+		encoded, err := encoder(t)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer := bytes.NewBuffer(nil)
+		if _, err := writeLV([]byte(tag), buffer); err != nil {
+			logger.Error("Failed to write type tag", "Error", err)
+			return nil, err
+		}
+		buffer.Write(encoded)
+
+		return buffer.Bytes(), nil
+	}
+}
+
+// Creates a decoder that reads the type tag ahead of each message and decodes the message as the registered type.
+func typeRegistryDecoder[R any](reg *TypeRegistry, unmarshal func([]byte, any) error) func([]byte) (R, error) {
+	return func(data []byte) (R, error) {
+		dataReader := bytes.NewReader(data)
+
+		tagBytes, n, err := readLV(dataReader)
+		if err != nil {
+			logger.Error("Failed to read type tag", "Error", err)
+			return *new(R), err
+		}
+
+		tag := string(tagBytes)
+		typ, ok := reg.types[tag]
+		if !ok {
+			logger.Error("Failed to read message. The type tag is unknown", "Tag", tag)
+			return *new(R), fmt.Errorf("%w: %q", ErrUnknownTypeTag, tag)
+		}
+
+		v := reflect.New(typ)
+		if err := unmarshal(data[n:], v.Interface()); err != nil {
+			logger.Error("Failed to decode registered type", "Tag", tag, "Type", typ, "Error", err)
+			return *new(R), err
+		}
+
+		logger.Debug("Decoded registered type", "Tag", tag, "Type", typ)
+		return v.Elem().Interface().(R), nil
+	}
+}
+
+// Wraps unmarshal to skip the type tag written by typeRegistryEncoder, decoding the rest of the message into whatever type it is given.
+func skipTypeTag(unmarshal func([]byte, any) error) func([]byte, any) error {
+	return func(data []byte, v any) error {
+		_, n, err := readLV(bytes.NewReader(data))
+		if err != nil {
+			logger.Error("Failed to read type tag", "Error", err)
+			return err
+		}
+
+		return unmarshal(data[n:], v)
+	}
+}
@@ -0,0 +1,331 @@
+package onthewire
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Describes why a single field failed validation. Path is the location of the field from the validated value, such as "Address.Lines[1]".
+type FieldError struct {
+	Path    string
+	Rule    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + " " + e.Message
+}
+
+// Returned by ValidateStruct and UseStructValidation when one or more fields break the rules in their `validate:"..."` tags.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Error())
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+type validationRule struct {
+	name  string
+	arg   string
+	bound float64
+	re    *regexp.Regexp
+}
+
+type validatedField struct {
+	index int
+	name  string
+	rules []validationRule
+}
+
+var validationPlanCache sync.Map
+
+type validationPlan struct {
+	fields []validatedField
+	err    error
+}
+
+// Checks v against the rules in the `validate:"..."` tags of its struct fields, including those of nested structs, slices and maps. Values without tags are always valid.
+//
+// Supported rules are required, min=, max=, len= and regex=, separated by commas. For numbers min and max bound the value, while for strings, slices and maps they bound the length. Since a regular expression may itself contain commas, regex must be the last rule in a tag.
+//
+// A *ValidationError is returned listing every field that failed. Any other error means a tag is malformed or doesn't suit its field.
+func ValidateStruct(v any) error {
+	var failures []FieldError
+	if err := validateValue(reflect.ValueOf(v), "", &failures); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return &ValidationError{Fields: failures}
+	}
+	return nil
+}
+
+// Checks that the `validate:"..."` tags reachable from t are well formed and suit the fields they are on.
+func checkValidationTags(t reflect.Type) error {
+	return checkValidationType(t, make(map[reflect.Type]bool))
+}
+
+func checkValidationType(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return checkValidationType(t.Elem(), seen)
+	case reflect.Struct:
+		plan := validationPlanFor(t)
+		if plan.err != nil {
+			return plan.err
+		}
+		for _, f := range plan.fields {
+			if err := checkValidationType(t.Field(f.index).Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validationPlanFor(t reflect.Type) *validationPlan {
+	if cached, ok := validationPlanCache.Load(t); ok {
+		return cached.(*validationPlan)
+	}
+
+	plan := &validationPlan{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		rules, err := parseValidationTag(f.Tag.Get("validate"), f.Type)
+		if err != nil {
+			plan = &validationPlan{err: fmt.Errorf("validate: %s.%s: %w", t, f.Name, err)}
+			break
+		}
+		plan.fields = append(plan.fields, validatedField{index: i, name: f.Name, rules: rules})
+	}
+
+	validationPlanCache.Store(t, plan)
+	return plan
+}
+
+func parseValidationTag(tag string, t reflect.Type) ([]validationRule, error) {
+	var rules []validationRule
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, arg, _ := strings.Cut(part, "=")
+		rule := validationRule{name: name, arg: arg}
+
+		switch name {
+		case "required":
+		case "min", "max", "len":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s has invalid bound %q", name, arg)
+			}
+			rule.bound = bound
+
+			if !hasValidationLength(t) && (name == "len" || !isValidationNumber(t)) {
+				return nil, fmt.Errorf("%s cannot be used with %s", name, t)
+			}
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("regex is invalid: %w", err)
+			}
+			if t.Kind() != reflect.String {
+				return nil, fmt.Errorf("regex cannot be used with %s", t)
+			}
+			rule.re = re
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func hasValidationLength(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func isValidationNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+var validatesTypeCache sync.Map
+
+// Reports whether values of t may hold fields with validation rules, so that values that can't, such as large []byte fields, are not looked into element by element.
+func validatesType(t reflect.Type) bool {
+	if cached, ok := validatesTypeCache.Load(t); ok {
+		return cached.(bool)
+	}
+
+	validates := hasValidatedFields(t, make(map[reflect.Type]bool))
+	validatesTypeCache.Store(t, validates)
+	return validates
+}
+
+// Looks for fields with validation rules through pointers, slices, arrays and maps to the structs within. Interfaces may hold anything so are always looked into.
+func hasValidatedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasValidatedFields(t.Elem(), seen)
+	case reflect.Struct:
+		plan := validationPlanFor(t)
+		if plan.err != nil {
+			// Looked into so that the error is returned
+			return true
+		}
+		for _, f := range plan.fields {
+			if len(f.rules) > 0 || hasValidatedFields(t.Field(f.index).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateValue(v reflect.Value, path string, failures *[]FieldError) error {
+	if !v.IsValid() || !validatesType(v.Type()) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validateValue(v.Elem(), path, failures)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), failures); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), failures); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		plan := validationPlanFor(v.Type())
+		if plan.err != nil {
+			return plan.err
+		}
+
+		for _, f := range plan.fields {
+			fieldPath := f.name
+			if path != "" {
+				fieldPath = path + "." + f.name
+			}
+
+			field := v.Field(f.index)
+			for _, rule := range f.rules {
+				if message, ok := rule.check(field); !ok {
+					*failures = append(*failures, FieldError{Path: fieldPath, Rule: rule.name, Message: message})
+				}
+			}
+
+			if err := validateValue(field, fieldPath, failures); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Checks the rule against v, returning a message describing the failure if it doesn't hold.
+func (r validationRule) check(v reflect.Value) (string, bool) {
+	if r.name == "required" {
+		return "is required", !isEmptyValue(v)
+	}
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", true
+		}
+		v = v.Elem()
+	}
+
+	switch r.name {
+	case "min", "max":
+		n, isLength := validationMeasure(v)
+		measure := "be"
+		if isLength {
+			measure = "have length"
+		}
+
+		if r.name == "min" {
+			return fmt.Sprintf("must %s at least %s", measure, r.arg), n >= r.bound
+		}
+		return fmt.Sprintf("must %s at most %s", measure, r.arg), n <= r.bound
+	case "len":
+		n, _ := validationMeasure(v)
+		return fmt.Sprintf("must have length %s", r.arg), n == r.bound
+	default:
+		return fmt.Sprintf("must match %s", r.arg), r.re.MatchString(v.String())
+	}
+}
+
+// Returns the length of strings, slices, arrays and maps, or the value of numbers. Strings are measured in runes.
+func validationMeasure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	default:
+		return v.Float(), false
+	}
+}
@@ -0,0 +1,35 @@
+package onthewire
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+)
+
+func xmlEncode[T any](t T) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+
+	xmlifier := xml.NewEncoder(buffer)
+	if err := xmlifier.Encode(t); err != nil {
+		logger.Error("Failed to XML encode", "Error", err)
+		return nil, err
+	}
+
+	logger.Debug("XML encoded", "Type", reflect.TypeOf(t), "ByteCount", len(buffer.Bytes()), "Bytes", logBytes(buffer.Bytes(), reflect.TypeOf(t)))
+	return buffer.Bytes(), nil
+}
+
+func xmlDecode[T any](data []byte) (T, error) {
+	t := *new(T)
+	if err := xmlUnmarshal(data, &t); err != nil {
+		logger.Debug("Failed to XML decode", "Error", err)
+		return t, err
+	}
+
+	logger.Debug("XML decoded", "Type", reflect.TypeOf(t), "Instance", logInstance(t))
+	return t, nil
+}
+
+func xmlUnmarshal(data []byte, v any) error {
+	return xml.NewDecoder(bytes.NewReader(data)).Decode(v)
+}